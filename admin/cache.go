@@ -0,0 +1,30 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/alxmorales2020/api-gateway/plugins/cache"
+)
+
+// DELETE /admin/cache?route={id}
+// DELETE /admin/cache?prefix={key prefix}
+//
+// Purges cached responses: those of one route, given by its ID (or path for
+// routes without one), or every entry whose key starts with prefix. Keys
+// look like "{route} GET /path?query". An empty prefix purges everything.
+func (h *AdminHandler) PurgeCache(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	var prefix string
+	switch {
+	case query.Get("route") != "":
+		prefix = query.Get("route") + " "
+	case query.Has("prefix"):
+		prefix = query.Get("prefix")
+	default:
+		http.Error(w, "route or prefix is required", http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"purged": cache.Purge(prefix)})
+}
@@ -0,0 +1,67 @@
+package admin
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+
+	"github.com/alxmorales2020/api-gateway/config"
+)
+
+// routeDiff lists the fields that differ between two versions of a route,
+// by dotted JSON path. Lists are compared as a whole. Either side may be nil.
+func routeDiff(before, after *config.RouteConfig) []config.FieldChange {
+	a, b := map[string]interface{}{}, map[string]interface{}{}
+	flatten("", routeJSON(before), a)
+	flatten("", routeJSON(after), b)
+	// The store manages these; they change on every write.
+	for _, m := range []map[string]interface{}{a, b} {
+		delete(m, "id")
+		delete(m, "revision")
+	}
+
+	var changes []config.FieldChange
+	for field, value := range a {
+		if other, ok := b[field]; !ok || !reflect.DeepEqual(value, other) {
+			changes = append(changes, config.FieldChange{Field: field, Before: value, After: other})
+		}
+	}
+	for field, value := range b {
+		if _, ok := a[field]; !ok {
+			changes = append(changes, config.FieldChange{Field: field, After: value})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+	return changes
+}
+
+func routeJSON(route *config.RouteConfig) interface{} {
+	if route == nil {
+		return nil
+	}
+	var doc interface{}
+	data, err := json.Marshal(route)
+	if err == nil {
+		err = json.Unmarshal(data, &doc)
+	}
+	if err != nil {
+		return nil
+	}
+	return doc
+}
+
+func flatten(prefix string, value interface{}, out map[string]interface{}) {
+	obj, ok := value.(map[string]interface{})
+	if !ok {
+		if value != nil && prefix != "" {
+			out[prefix] = value
+		}
+		return
+	}
+	for key, item := range obj {
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		flatten(key, item, out)
+	}
+}
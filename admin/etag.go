@@ -0,0 +1,32 @@
+package admin
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/alxmorales2020/api-gateway/config"
+)
+
+// etag formats a route revision as a strong entity tag.
+func etag(revision int64) string {
+	return fmt.Sprintf("%q", strconv.FormatInt(revision, 10))
+}
+
+// ifMatch returns the revision a write is conditional on: the one named in
+// the If-Match header, or config.AnyRevision without the header or for "*".
+// It writes a 412 and returns false if the header names no revision.
+func ifMatch(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	value := strings.TrimSpace(r.Header.Get("If-Match"))
+	if value == "" || value == "*" {
+		return config.AnyRevision, true
+	}
+	if unquoted, err := strconv.Unquote(value); err == nil {
+		if revision, err := strconv.ParseInt(unquoted, 10, 64); err == nil && revision >= 0 {
+			return revision, true
+		}
+	}
+	http.Error(w, "If-Match does not name a route revision", http.StatusPreconditionFailed)
+	return 0, false
+}
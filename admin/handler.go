@@ -2,6 +2,7 @@ package admin
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 
@@ -13,12 +14,12 @@ import (
 )
 
 type AdminHandler struct {
-	store    config.RouteStore
-	reloader router.Reloader
+	store   config.RouteStore
+	runtime router.Runtime
 }
 
-func NewAdminHandler(store config.RouteStore, reloader router.Reloader) *AdminHandler {
-	return &AdminHandler{store: store, reloader: reloader}
+func NewAdminHandler(store config.RouteStore, runtime router.Runtime) *AdminHandler {
+	return &AdminHandler{store: store, runtime: runtime}
 }
 
 // Routes registers admin endpoints
@@ -29,8 +30,23 @@ func (h *AdminHandler) Routes() http.Handler {
 	r.Route("/routes", func(r chi.Router) {
 		r.Get("/", h.GetRoutes)          // GET    /admin/routes
 		r.Post("/", h.CreateRoute)       // POST   /admin/routes
+		r.Get("/{id}", h.GetRoute)       // GET    /admin/routes/{id}
+		r.Put("/{id}", h.ReplaceRoute)   // PUT    /admin/routes/{id}
+		r.Patch("/{id}", h.PatchRoute)   // PATCH  /admin/routes/{id}
 		r.Delete("/{id}", h.DeleteRoute) // DELETE /admin/routes/{id}
+
+		r.Get("/{id}/history", h.GetRouteHistory) // GET    /admin/routes/{id}/history
+		r.Post("/{id}/rollback", h.RollbackRoute) // POST   /admin/routes/{id}/rollback?revision=N
+	})
+	r.Route("/snapshots", func(r chi.Router) {
+		r.Get("/", h.GetSnapshots)                 // GET    /admin/snapshots
+		r.Post("/", h.CreateSnapshot)              // POST   /admin/snapshots
+		r.Get("/{id}", h.GetSnapshot)              // GET    /admin/snapshots/{id}
+		r.Post("/{id}/restore", h.RestoreSnapshot) // POST   /admin/snapshots/{id}/restore
 	})
+	r.Get("/upstreams", h.GetUpstreams) // GET    /admin/upstreams
+	r.Post("/reload", h.ReloadRoutes)   // POST   /admin/reload[?dry_run=true]
+	r.Delete("/cache", h.PurgeCache)    // DELETE /admin/cache?route={id}|prefix={key prefix}
 
 	// Helpful: see 405 vs 404 clearly
 	r.MethodNotAllowed(func(w http.ResponseWriter, req *http.Request) {
@@ -64,23 +80,19 @@ func (h *AdminHandler) CreateRoute(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Basic validation
-	if route.Path == "" || route.Upstream == "" || len(route.Methods) == 0 {
-		http.Error(w, "Missing required route fields", http.StatusBadRequest)
+	if !h.validRoute(w, &route) {
 		return
 	}
 
-	if err := h.store.SaveRoute(&route); err != nil {
-		http.Error(w, "Failed to save route", http.StatusInternalServerError)
+	route.Revision = 0
+	save := func() error { return h.store.SaveRoute(&route) }
+	if !h.applyRoute(w, &route, save, "Failed to save route") {
 		return
 	}
+	h.record(r, config.ActionCreate, nil, &route)
 
-	// Hot-reload the router after save
-	if err := h.reloader.Reload(); err != nil {
-		http.Error(w, "saved but reload failed", http.StatusInternalServerError)
-		return
-	}
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", etag(route.Revision))
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(map[string]any{
 		"id":      route.ID,
@@ -88,6 +100,137 @@ func (h *AdminHandler) CreateRoute(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// GET /admin/routes/{id}
+func (h *AdminHandler) GetRoute(w http.ResponseWriter, r *http.Request) {
+	route, err := h.store.GetRoute(chi.URLParam(r, "id"))
+	if err != nil {
+		storeError(w, err, "Failed to load route")
+		return
+	}
+	writeRoute(w, route)
+}
+
+// PUT /admin/routes/{id}
+func (h *AdminHandler) ReplaceRoute(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	var route config.RouteConfig
+	if err := json.NewDecoder(r.Body).Decode(&route); err != nil {
+		http.Error(w, "Invalid route data", http.StatusBadRequest)
+		return
+	}
+	if route.ID != "" && route.ID != id {
+		http.Error(w, "route id in body does not match URL", http.StatusBadRequest)
+		return
+	}
+	route.ID = id
+	expected, ok := ifMatch(w, r)
+	if !ok {
+		return
+	}
+	before, err := h.store.GetRoute(id)
+	if err != nil {
+		storeError(w, err, "Failed to load route")
+		return
+	}
+	h.updateRoute(w, r, before, &route, expected)
+}
+
+// PATCH /admin/routes/{id}
+// The body is a JSON merge patch (RFC 7396) applied to the stored route. The
+// update is conditional on the revision the patch was applied to, so a
+// concurrent write is never overwritten.
+func (h *AdminHandler) PatchRoute(w http.ResponseWriter, r *http.Request) {
+	if ct := r.Header.Get("Content-Type"); ct != "" && !isMergePatch(ct) {
+		http.Error(w, "PATCH expects application/merge-patch+json", http.StatusUnsupportedMediaType)
+		return
+	}
+	id := chi.URLParam(r, "id")
+	var patch interface{}
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		http.Error(w, "Invalid patch data", http.StatusBadRequest)
+		return
+	}
+
+	expected, ok := ifMatch(w, r)
+	if !ok {
+		return
+	}
+	current, err := h.store.GetRoute(id)
+	if err != nil {
+		storeError(w, err, "Failed to load route")
+		return
+	}
+	if expected != config.AnyRevision && expected != current.Revision {
+		storeError(w, &config.RevisionMismatchError{ID: id, Expected: expected, Actual: current.Revision}, "")
+		return
+	}
+	route, err := applyMergePatch(current, patch)
+	if err != nil {
+		http.Error(w, "Invalid patch data: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	route.ID = id
+	h.updateRoute(w, r, current, route, current.Revision)
+}
+
+// updateRoute validates and stores a changed route if the stored one is at
+// the expected revision, records the change and reloads the router.
+func (h *AdminHandler) updateRoute(w http.ResponseWriter, r *http.Request, before, route *config.RouteConfig, expected int64) {
+	if !h.validRoute(w, route) {
+		return
+	}
+	update := func() error { return h.store.UpdateRoute(route, expected) }
+	if !h.applyRoute(w, route, update, "Failed to update route") {
+		return
+	}
+	h.record(r, config.ActionUpdate, before, route)
+	writeRoute(w, route)
+}
+
+// applyRoute builds a router from the stored routes with route in place of
+// the stored route with its ID, or added, and only once that succeeds calls
+// write to store the route and swaps the router in. A route the router cannot
+// serve is never stored. On failure it writes the response and returns false:
+// 422 if the router does not build, or the store's error from write.
+func (h *AdminHandler) applyRoute(w http.ResponseWriter, route *config.RouteConfig, write func() error, msg string) bool {
+	routes, err := h.store.LoadRoutes()
+	if err != nil {
+		storeError(w, err, "Failed to load routes")
+		return false
+	}
+	index := -1
+	for i := range routes {
+		if route.ID != "" && routes[i].ID == route.ID {
+			routes[i], index = *route, i
+		}
+	}
+	if index < 0 {
+		routes, index = append(routes, *route), len(routes)
+	}
+
+	var writeErr error
+	err = h.runtime.ReloadRoutes(routes, func() error {
+		if writeErr = write(); writeErr != nil {
+			return writeErr
+		}
+		// The store sets the ID and revision; serve the route as stored.
+		routes[index] = *route
+		return nil
+	})
+	var invalid *router.ValidationError
+	switch {
+	case err == nil:
+		return true
+	case writeErr != nil:
+		storeError(w, writeErr, msg)
+	case errors.As(err, &invalid):
+		validationFailed(w, invalid.Errors)
+	default:
+		http.Error(w, "route cannot be served: "+err.Error(), http.StatusUnprocessableEntity)
+	}
+	return false
+}
+
 // DELETE /admin/routes/{id}
 func (h *AdminHandler) DeleteRoute(w http.ResponseWriter, r *http.Request) {
 	id := chi.URLParam(r, "id")
@@ -96,18 +239,85 @@ func (h *AdminHandler) DeleteRoute(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.store.DeleteRoute(id); err != nil {
-		// You can map specific errors to 404 if your store returns them
-		http.Error(w, "route not found", http.StatusNotFound)
+	expected, ok := ifMatch(w, r)
+	if !ok {
 		return
 	}
+	before, err := h.store.GetRoute(id)
+	if err != nil {
+		storeError(w, err, "Failed to load route")
+		return
+	}
+	if err := h.store.DeleteRoute(id, expected); err != nil {
+		storeError(w, err, "Failed to delete route")
+		return
+	}
+	h.record(r, config.ActionDelete, before, nil)
 
 	// Hot-reload the router after delete
-	if err := h.reloader.Reload(); err != nil {
-		http.Error(w, "deleted but reload failed", http.StatusInternalServerError)
+	if err := h.runtime.Reload(); err != nil {
+		http.Error(w, "deleted but reload failed: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	// Either 204 No Content (common for delete)...
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// GET /admin/upstreams
+func (h *AdminHandler) GetUpstreams(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.runtime.Upstreams())
+}
+
+// validRoute checks a route with router.ValidateRoute and against the other
+// stored routes, and writes a 422 listing every problem if it is invalid.
+func (h *AdminHandler) validRoute(w http.ResponseWriter, route *config.RouteConfig) bool {
+	errs := router.ValidateRoute(*route)
+	routes, err := h.store.LoadRoutes()
+	if err != nil {
+		storeError(w, err, "Failed to load routes")
+		return false
+	}
+	errs = append(errs, router.RouteConflicts(*route, routes)...)
+	if len(errs) > 0 {
+		validationFailed(w, errs)
+		return false
+	}
+	return true
+}
+
+// validationFailed writes a 422 with the field-level errors of a route
+// definition.
+func validationFailed(w http.ResponseWriter, errs []router.FieldError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	json.NewEncoder(w).Encode(map[string]any{
+		"error":  "invalid route",
+		"errors": errs,
+	})
+}
+
+// storeError writes 404 for a missing route, 412 for a failed conditional
+// write, 409 for a duplicate route ID and 500 with msg otherwise.
+func storeError(w http.ResponseWriter, err error, msg string) {
+	switch {
+	case errors.Is(err, config.ErrRouteNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, config.ErrRevisionMismatch):
+		http.Error(w, err.Error(), http.StatusPreconditionFailed)
+		return
+	case errors.Is(err, config.ErrRouteExists):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	log.Printf("admin: %s: %v", msg, err)
+	http.Error(w, msg, http.StatusInternalServerError)
+}
+
+func writeRoute(w http.ResponseWriter, route *config.RouteConfig) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", etag(route.Revision))
+	json.NewEncoder(w).Encode(route)
+}
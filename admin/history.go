@@ -0,0 +1,327 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	"github.com/alxmorales2020/api-gateway/config"
+	"github.com/alxmorales2020/api-gateway/core"
+	"github.com/alxmorales2020/api-gateway/router"
+)
+
+// historyStore returns the store's history, or writes a 501 if the store
+// keeps none.
+func (h *AdminHandler) historyStore(w http.ResponseWriter) (config.HistoryStore, bool) {
+	history, ok := h.store.(config.HistoryStore)
+	if !ok {
+		http.Error(w, "route store does not keep history", http.StatusNotImplemented)
+	}
+	return history, ok
+}
+
+// record appends a change to the route history, if the store keeps one.
+// The write it describes has already happened, so failures are only logged.
+func (h *AdminHandler) record(r *http.Request, action string, before, after *config.RouteConfig) {
+	history, ok := h.store.(config.HistoryStore)
+	if !ok {
+		return
+	}
+	change := &config.RouteChange{
+		Action: action,
+		Actor:  actor(r),
+		Time:   time.Now().UTC(),
+		Before: before,
+		After:  after,
+		Diff:   routeDiff(before, after),
+	}
+	if after != nil {
+		change.RouteID, change.Revision = after.ID, after.Revision
+	} else {
+		change.RouteID, change.Revision = before.ID, before.Revision
+	}
+	if err := history.RecordChange(change); err != nil {
+		log.Printf("admin: recording %s of route %s: %v", action, change.RouteID, err)
+	}
+}
+
+// actor identifies who made a change: the X-Admin-User header, or the
+// client IP without it.
+func actor(r *http.Request) string {
+	if user := r.Header.Get("X-Admin-User"); user != "" {
+		return user
+	}
+	return core.ClientIP(r)
+}
+
+// GET /admin/routes/{id}/history
+func (h *AdminHandler) GetRouteHistory(w http.ResponseWriter, r *http.Request) {
+	history, ok := h.historyStore(w)
+	if !ok {
+		return
+	}
+	changes, err := history.RouteHistory(chi.URLParam(r, "id"))
+	if err != nil {
+		storeError(w, err, "Failed to load route history")
+		return
+	}
+	if changes == nil {
+		changes = []config.RouteChange{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(changes)
+}
+
+// POST /admin/routes/{id}/rollback?revision=N
+// Writes the route as it was at revision N, as a new revision. A deleted
+// route is recreated.
+func (h *AdminHandler) RollbackRoute(w http.ResponseWriter, r *http.Request) {
+	history, ok := h.historyStore(w)
+	if !ok {
+		return
+	}
+	id := chi.URLParam(r, "id")
+	revision, err := strconv.ParseInt(r.URL.Query().Get("revision"), 10, 64)
+	if err != nil {
+		http.Error(w, "revision must be a number", http.StatusBadRequest)
+		return
+	}
+	expected, ok := ifMatch(w, r)
+	if !ok {
+		return
+	}
+
+	changes, err := history.RouteHistory(id)
+	if err != nil {
+		storeError(w, err, "Failed to load route history")
+		return
+	}
+	var target *config.RouteConfig
+	for _, change := range changes {
+		if change.After != nil && change.After.Revision == revision {
+			route := *change.After
+			target = &route
+			break
+		}
+	}
+	if target == nil {
+		http.Error(w, fmt.Sprintf("route %q has no recorded revision %d", id, revision), http.StatusNotFound)
+		return
+	}
+	target.ID = id
+	if !h.validRoute(w, target) {
+		return
+	}
+
+	current, err := h.store.GetRoute(id)
+	switch {
+	case errors.Is(err, config.ErrRouteNotFound) && expected != config.AnyRevision:
+		err = &config.RevisionMismatchError{ID: id, Expected: expected}
+	case errors.Is(err, config.ErrRouteNotFound):
+		target.Revision = nextRevision(changes)
+		err = h.store.SaveRoute(target)
+		current = nil
+	case err == nil:
+		err = h.store.UpdateRoute(target, expected)
+	}
+	if err != nil {
+		storeError(w, err, "Failed to roll back route")
+		return
+	}
+	h.record(r, config.ActionRollback, current, target)
+
+	if err := h.runtime.Reload(); err != nil {
+		http.Error(w, "rolled back but reload failed: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeRoute(w, target)
+}
+
+// GET /admin/snapshots
+func (h *AdminHandler) GetSnapshots(w http.ResponseWriter, r *http.Request) {
+	history, ok := h.historyStore(w)
+	if !ok {
+		return
+	}
+	snapshots, err := history.ListSnapshots()
+	if err != nil {
+		storeError(w, err, "Failed to load snapshots")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(snapshots)
+}
+
+// POST /admin/snapshots
+// Takes a snapshot of all routes. The body may carry a {"note": "..."}.
+func (h *AdminHandler) CreateSnapshot(w http.ResponseWriter, r *http.Request) {
+	history, ok := h.historyStore(w)
+	if !ok {
+		return
+	}
+	var body struct {
+		Note string `json:"note"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && err != io.EOF {
+		http.Error(w, "Invalid snapshot data", http.StatusBadRequest)
+		return
+	}
+
+	snapshot, err := h.snapshot(history, r, body.Note)
+	if err != nil {
+		storeError(w, err, "Failed to save snapshot")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(snapshot)
+}
+
+func (h *AdminHandler) snapshot(history config.HistoryStore, r *http.Request, note string) (*config.Snapshot, error) {
+	routes, err := h.store.LoadRoutes()
+	if err != nil {
+		return nil, err
+	}
+	snapshot := &config.Snapshot{Time: time.Now().UTC(), Actor: actor(r), Note: note, Routes: routes}
+	if err := history.SaveSnapshot(snapshot); err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// GET /admin/snapshots/{id}
+func (h *AdminHandler) GetSnapshot(w http.ResponseWriter, r *http.Request) {
+	history, ok := h.historyStore(w)
+	if !ok {
+		return
+	}
+	snapshot, err := history.GetSnapshot(chi.URLParam(r, "id"))
+	if err != nil {
+		snapshotError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(snapshot)
+}
+
+// POST /admin/snapshots/{id}/restore
+// Makes the routes match the snapshot: routes created since are deleted and
+// the others written back. The current routes are snapshotted first, so a
+// restore can itself be undone.
+func (h *AdminHandler) RestoreSnapshot(w http.ResponseWriter, r *http.Request) {
+	history, ok := h.historyStore(w)
+	if !ok {
+		return
+	}
+	snapshot, err := history.GetSnapshot(chi.URLParam(r, "id"))
+	if err != nil {
+		snapshotError(w, err)
+		return
+	}
+	var invalid *router.ValidationError
+	if errors.As(router.ValidateRoutes(snapshot.Routes), &invalid) {
+		validationFailed(w, invalid.Errors)
+		return
+	}
+	backup, err := h.snapshot(history, r, "before restore of snapshot "+snapshot.ID)
+	if err != nil {
+		storeError(w, err, "Failed to save snapshot")
+		return
+	}
+
+	current := map[string]config.RouteConfig{}
+	for _, route := range backup.Routes {
+		current[route.ID] = route
+	}
+	wanted := map[string]bool{}
+	changed := 0
+	err = func() error {
+		for i := range snapshot.Routes {
+			route := snapshot.Routes[i]
+			wanted[route.ID] = true
+			before, exists := current[route.ID]
+			if !exists {
+				changes, err := history.RouteHistory(route.ID)
+				if err != nil {
+					return err
+				}
+				route.Revision = nextRevision(changes)
+				if err := h.store.SaveRoute(&route); err != nil {
+					return err
+				}
+				h.record(r, config.ActionRestore, nil, &route)
+				changed++
+				continue
+			}
+			if len(routeDiff(&before, &route)) == 0 {
+				continue
+			}
+			if err := h.store.UpdateRoute(&route, config.AnyRevision); err != nil {
+				return err
+			}
+			h.record(r, config.ActionRestore, &before, &route)
+			changed++
+		}
+		for id, before := range current {
+			if wanted[id] {
+				continue
+			}
+			if err := h.store.DeleteRoute(id, config.AnyRevision); err != nil && !errors.Is(err, config.ErrRouteNotFound) {
+				return err
+			}
+			h.record(r, config.ActionDelete, &before, nil)
+			changed++
+		}
+		return nil
+	}()
+
+	// Serve whatever was written, even after a partial restore.
+	if reloadErr := h.runtime.Reload(); err == nil && reloadErr != nil {
+		http.Error(w, "restored but reload failed: "+reloadErr.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err != nil {
+		log.Printf("admin: restoring snapshot %s: %v", snapshot.ID, err)
+		http.Error(w, fmt.Sprintf("restore failed after %d changes, backup snapshot %s: %v", changed, backup.ID, err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"snapshot": snapshot.ID,
+		"backup":   backup.ID,
+		"changed":  changed,
+	})
+}
+
+func snapshotError(w http.ResponseWriter, err error) {
+	if errors.Is(err, config.ErrSnapshotNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	storeError(w, err, "Failed to load snapshot")
+}
+
+// nextRevision returns the revision after the highest one recorded in
+// changes, so a recreated route never reuses a revision (and ETag) of the
+// route it replaces.
+func nextRevision(changes []config.RouteChange) int64 {
+	var highest int64
+	for _, change := range changes {
+		if change.Revision > highest {
+			highest = change.Revision
+		}
+		for _, route := range []*config.RouteConfig{change.Before, change.After} {
+			if route != nil && route.Revision > highest {
+				highest = route.Revision
+			}
+		}
+	}
+	return highest + 1
+}
@@ -0,0 +1,58 @@
+package admin
+
+import (
+	"encoding/json"
+	"mime"
+
+	"github.com/alxmorales2020/api-gateway/config"
+)
+
+func isMergePatch(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && (mediaType == "application/merge-patch+json" || mediaType == "application/json")
+}
+
+// applyMergePatch applies a JSON merge patch (RFC 7396) to route and returns
+// the patched copy.
+func applyMergePatch(route *config.RouteConfig, patch interface{}) (*config.RouteConfig, error) {
+	data, err := json.Marshal(route)
+	if err != nil {
+		return nil, err
+	}
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	merged, err := json.Marshal(mergePatch(doc, patch))
+	if err != nil {
+		return nil, err
+	}
+	var out config.RouteConfig
+	if err := json.Unmarshal(merged, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// mergePatch implements the MergePatch function of RFC 7396: objects are
+// merged recursively, null removes a member and any other value replaces
+// the target.
+func mergePatch(target, patch interface{}) interface{} {
+	patchObj, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	targetObj, ok := target.(map[string]interface{})
+	if !ok {
+		targetObj = map[string]interface{}{}
+	}
+	for name, value := range patchObj {
+		if value == nil {
+			delete(targetObj, name)
+			continue
+		}
+		targetObj[name] = mergePatch(targetObj[name], value)
+	}
+	return targetObj
+}
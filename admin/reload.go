@@ -0,0 +1,111 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+
+	"github.com/alxmorales2020/api-gateway/config"
+	"github.com/alxmorales2020/api-gateway/router"
+)
+
+// reloadReport is the answer to POST /admin/reload: what the reload changes
+// compared to the routes serving before it, and why it failed if it did.
+type reloadReport struct {
+	DryRun    bool                 `json:"dry_run"`
+	Reloaded  bool                 `json:"reloaded"`
+	Error     string               `json:"error,omitempty"`
+	Errors    []router.FieldError  `json:"errors,omitempty"`
+	Added     []config.RouteConfig `json:"added"`
+	Removed   []config.RouteConfig `json:"removed"`
+	Changed   []changedRoute       `json:"changed"`
+	Unchanged int                  `json:"unchanged"`
+}
+
+type changedRoute struct {
+	ID   string               `json:"id"`
+	Path string               `json:"path"`
+	Diff []config.FieldChange `json:"diff"`
+}
+
+// POST /admin/reload[?dry_run=true]
+//
+// Builds a router from the stored routes and swaps it in, or with dry_run
+// only reports what would change. A candidate that fails to build is never
+// swapped in; the answer is then 422 with the build errors.
+func (h *AdminHandler) ReloadRoutes(w http.ResponseWriter, r *http.Request) {
+	dryRun := r.URL.Query().Get("dry_run") == "true"
+
+	check, err := h.runtime.DryRun()
+	if err != nil {
+		storeError(w, err, "Failed to load routes")
+		return
+	}
+	report := compareRoutes(check.Serving, check.Candidate)
+	report.DryRun = dryRun
+
+	err = check.Err
+	if err == nil && !dryRun {
+		// The store may have changed since the check; Reload builds again
+		// and refuses to swap if that fails.
+		err = h.runtime.Reload()
+		report.Reloaded = err == nil
+	}
+
+	status := http.StatusOK
+	if err != nil {
+		status = http.StatusUnprocessableEntity
+		report.Error = err.Error()
+		var invalid *router.ValidationError
+		if errors.As(err, &invalid) {
+			report.Errors = invalid.Errors
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(report)
+}
+
+// compareRoutes matches routes by ID and lists the ones added, removed and
+// changed by going from serving to candidate.
+func compareRoutes(serving, candidate []config.RouteConfig) *reloadReport {
+	report := &reloadReport{
+		Added:   []config.RouteConfig{},
+		Removed: []config.RouteConfig{},
+		Changed: []changedRoute{},
+	}
+	before := map[string]*config.RouteConfig{}
+	for i := range serving {
+		before[routeKey(&serving[i])] = &serving[i]
+	}
+	for i := range candidate {
+		route := &candidate[i]
+		key := routeKey(route)
+		old, ok := before[key]
+		if !ok {
+			report.Added = append(report.Added, *route)
+			continue
+		}
+		delete(before, key)
+		if diff := routeDiff(old, route); len(diff) > 0 {
+			report.Changed = append(report.Changed, changedRoute{ID: route.ID, Path: route.Path, Diff: diff})
+		} else {
+			report.Unchanged++
+		}
+	}
+	for _, route := range before {
+		report.Removed = append(report.Removed, *route)
+	}
+	sort.Slice(report.Removed, func(i, j int) bool { return report.Removed[i].Path < report.Removed[j].Path })
+	return report
+}
+
+// routeKey identifies a route across reloads: its ID, or its path for
+// routes without one.
+func routeKey(route *config.RouteConfig) string {
+	if route.ID != "" {
+		return route.ID
+	}
+	return route.Path
+}
@@ -1,22 +1,28 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/alxmorales2020/api-gateway/admin"
 	"github.com/alxmorales2020/api-gateway/config"
 	"github.com/alxmorales2020/api-gateway/core"
 	"github.com/alxmorales2020/api-gateway/plugins/auth"
+	"github.com/alxmorales2020/api-gateway/plugins/body"
+	"github.com/alxmorales2020/api-gateway/plugins/cache"
+	"github.com/alxmorales2020/api-gateway/plugins/headers"
 	"github.com/alxmorales2020/api-gateway/plugins/logging"
+	"github.com/alxmorales2020/api-gateway/plugins/ratelimit"
 	"github.com/alxmorales2020/api-gateway/router"
 	"github.com/go-chi/chi/v5"
 )
 
 // main initializes the API Gateway, loads the configuration, and starts the HTTP server.
-// It sets up the router and listens on port 8080.
+// It sets up the router and listens on the configured address (port 8080 by default).
 // The configuration is loaded from a YAML file named "config.yaml".
-// The router is created using the NewRouter function from the router package.
+// The router is created and hot-reloaded by a router.Manager over the route store.
 // The server listens for incoming HTTP requests and routes them according to the configuration.
 // It also mounts the admin API for managing routes and plugins.
 func main() {
@@ -28,22 +34,70 @@ func main() {
 	registerPlugin()
 
 	var store config.RouteStore
-	if gatewayConfig.Persistence.MongoDB != nil {
+	reloader := &configReloader{path: "config.yaml", routesFile: "config.yaml", initial: gatewayConfig}
+	if boltConfig := gatewayConfig.Persistence.Bolt; boltConfig != nil {
+		boltStore, err := config.NewBoltRouteStore(boltConfig)
+		if err != nil {
+			log.Fatalf("Error opening route database: %v", err)
+		}
+		if boltConfig.ImportFrom != "" {
+			importRoutes(boltStore, boltConfig.ImportFrom, gatewayConfig)
+		}
+		store = boltStore
+		log.Println("Loaded route configuration from the embedded database.")
+	} else if gatewayConfig.Persistence.MongoDB != nil {
 		store, err = config.NewMongoRouteStore(gatewayConfig.Persistence.MongoDB)
 		if err != nil {
 			log.Fatalf("Error connecting to MongoDB: %v", err)
 		}
 		log.Println("Loaded route configuration from MongoDB.")
+		useSharedRateLimits(store.(*config.MongoRouteStore), gatewayConfig.Persistence.MongoDB)
+	} else if yamlConfig := gatewayConfig.Persistence.YAML; yamlConfig != nil && yamlConfig.WriteBack {
+		routesFile := yamlConfig.RoutesFile
+		if routesFile == "" {
+			routesFile = "config.yaml"
+		}
+		reloader.store, err = config.NewYAMLFileRouteStore(routesFile, gatewayConfig.Routes)
+		if err != nil {
+			log.Fatalf("Error loading routes from %s: %v", routesFile, err)
+		}
+		reloader.routesFile = routesFile
+		store = reloader.store
+		log.Printf("Loaded route configuration from %s, writing changes back.", routesFile)
 	} else {
-		store = config.NewYAMLRouteStore(gatewayConfig.Routes)
+		reloader.store = config.NewYAMLRouteStore(gatewayConfig.Routes)
+		reloader.trackFileRoutes()
+		store = reloader.store
 		log.Println("Loaded route configuration from config.yaml.")
 	}
+	if reloader.store != nil {
+		// Fail fast on broken routes in the config file.
+		routes, _ := reloader.store.LoadRoutes()
+		if err := router.ValidateRoutes(routes); err != nil {
+			log.Fatalf("Error loading configuration from %s: %v", reloader.routesFile, err)
+		}
+	}
 
 	// Hot-reloadable app router
 	manager, err := router.NewManager(store)
 	if err != nil {
 		log.Fatalf("router manager: %v", err)
 	}
+	var debounce time.Duration
+	if _, ok := store.(*config.MongoRouteStore); ok {
+		debounce = gatewayConfig.Persistence.MongoDB.ReloadDebounce.Std()
+	}
+	if manager.Watch(context.Background(), debounce) {
+		log.Println("Watching route store for changes from other instances.")
+	}
+
+	// Routes edited in the config file are picked up without a restart;
+	// SIGHUP forces a reload.
+	reloader.manager = manager
+	if reloader.store != nil {
+		go reloader.watch(context.Background())
+	}
+	go reloader.handleSignals()
 
 	// Top-level router
 	top := chi.NewRouter()
@@ -59,12 +113,76 @@ func main() {
 		http.Error(w, "not found", http.StatusNotFound)
 	})
 
-	log.Println("Starting API Gateway on :8080")
-	if err := http.ListenAndServe(":8080", top); err != nil {
+	server := newServer(gatewayConfig.Server, top)
+	log.Printf("Starting API Gateway on %s", server.Addr)
+	if err := server.ListenAndServe(); err != nil {
 		log.Fatalf("server: %v", err)
 	}
 }
 
+// newServer creates the HTTP server with the listener timeouts from config.yaml.
+// Unset timeouts are left at zero, which means no timeout.
+func newServer(cfg config.ServerConfig, handler http.Handler) *http.Server {
+	addr := cfg.Address
+	if addr == "" {
+		addr = ":8080"
+	}
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadTimeout:       cfg.ReadTimeout.Std(),
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout.Std(),
+		WriteTimeout:      cfg.WriteTimeout.Std(),
+		IdleTimeout:       cfg.IdleTimeout.Std(),
+	}
+}
+
+// useSharedRateLimits keeps the counters of cluster-scoped rate limits in the
+// route store's MongoDB database, so all replicas share them. If that fails,
+// those limits fall back to per-replica counting.
+func useSharedRateLimits(store *config.MongoRouteStore, cfg *config.MongoDBConfig) {
+	collection := cfg.RateLimitCollection
+	if collection == "" {
+		collection = "ratelimits"
+	}
+	backend, err := ratelimit.NewMongoBackend(store.Database(), collection)
+	if err != nil {
+		log.Printf("WARNING: shared rate limiting unavailable, limiting per replica: %v", err)
+		return
+	}
+	ratelimit.SetBackend(backend)
+}
+
+// importRoutes seeds an empty embedded database with the routes, history and
+// snapshots of MongoDB, or with the routes of config.yaml.
+func importRoutes(store *config.BoltRouteStore, from string, cfg *config.GatewayConfig) {
+	var src config.RouteStore
+	switch from {
+	case "mongodb":
+		if cfg.Persistence.MongoDB == nil {
+			log.Fatalf("Cannot import routes from MongoDB: persistence.mongodb is not configured")
+		}
+		mongoStore, err := config.NewMongoRouteStore(cfg.Persistence.MongoDB)
+		if err != nil {
+			log.Fatalf("Error connecting to MongoDB: %v", err)
+		}
+		defer mongoStore.(*config.MongoRouteStore).Close()
+		src = mongoStore
+	case "yaml":
+		src = config.NewYAMLRouteStore(cfg.Routes)
+	default:
+		log.Fatalf("Unknown persistence.bolt.import_from %q (use mongodb or yaml)", from)
+	}
+
+	n, err := store.Import(src)
+	if err != nil {
+		log.Fatalf("Error importing routes from %s: %v", from, err)
+	}
+	if n > 0 {
+		log.Printf("Imported %d route(s) from %s into the embedded database.", n, from)
+	}
+}
+
 // registerPlugin registers a plugin with the core plugin manager.
 // It takes a plugin name and a function that returns a new instance of the plugin.
 // This function is used to dynamically load plugins at runtime.
@@ -73,4 +191,8 @@ func main() {
 func registerPlugin() {
 	core.RegisterPlugin("logging", logging.New)
 	core.RegisterPlugin("jwt-auth", auth.New)
+	core.RegisterPlugin("rate-limit", ratelimit.New)
+	core.RegisterPlugin("header-transform", headers.New)
+	core.RegisterPlugin("body-transform", body.New)
+	core.RegisterPlugin("cache", cache.New)
 }
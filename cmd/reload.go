@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/alxmorales2020/api-gateway/config"
+	"github.com/alxmorales2020/api-gateway/router"
+)
+
+// configReloader applies edits to config.yaml without a restart. Only routes
+// and their plugin configs are reloaded; server and persistence settings are
+// read once at startup.
+type configReloader struct {
+	mu         sync.Mutex
+	path       string
+	routesFile string                 // file the routes live in, path unless write-back uses its own file
+	store      *config.YAMLRouteStore // nil when routes come from MongoDB
+	manager    *router.Manager
+	initial    *config.GatewayConfig
+
+	// fileIDs holds the IDs of the routes read from the config file when
+	// the store does not write back to it. Other routes were created through
+	// the admin API and survive reloads. nil when the file holds every route.
+	fileIDs map[string]bool
+}
+
+// trackFileRoutes marks the routes of the store as read from the config
+// file, so routes added later through the admin API are kept on reload.
+func (c *configReloader) trackFileRoutes() {
+	routes, _ := c.store.LoadRoutes()
+	c.fileIDs = map[string]bool{}
+	for _, route := range routes {
+		c.fileIDs[route.ID] = true
+	}
+}
+
+// reload re-reads the config and swaps in its routes. A file that does not
+// parse or whose routes fail to build is rejected, and the last good config
+// keeps serving.
+func (c *configReloader) reload() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.store == nil {
+		if err := c.manager.Reload(); err != nil {
+			log.Printf("Config reload failed, keeping last good config: %v", err)
+		}
+		return
+	}
+
+	cfg, err := config.LoadConfig(c.path)
+	if err != nil {
+		log.Printf("Config reload: %s rejected, keeping last good config: %v", c.path, err)
+		return
+	}
+	if cfg.Server != c.initial.Server {
+		log.Printf("WARNING: server settings in %s changed; restart the gateway to apply them", c.path)
+	}
+
+	routes := cfg.Routes
+	if c.routesFile != c.path {
+		fileRoutes, found, err := config.ReadRoutesFile(c.routesFile)
+		if err != nil {
+			log.Printf("Config reload: %s rejected, keeping last good config: %v", c.routesFile, err)
+			return
+		}
+		if found {
+			routes = fileRoutes
+		}
+	}
+
+	resolved := c.store.Resolve(routes)
+	fromFile := map[string]bool{}
+	for _, route := range resolved {
+		fromFile[route.ID] = true
+	}
+	current, _ := c.store.LoadRoutes()
+	var removed []string
+	for _, route := range current {
+		switch {
+		case fromFile[route.ID]:
+		case c.fileIDs != nil && !c.fileIDs[route.ID]:
+			resolved = append(resolved, route) // created through the admin API
+		default:
+			removed = append(removed, route.ID)
+		}
+	}
+
+	err = c.manager.ReloadRoutes(resolved, func() error {
+		return c.store.ReplaceRoutes(resolved)
+	})
+	if err != nil {
+		log.Printf("Config reload: routes rejected, keeping last good config: %v", err)
+		return
+	}
+	if c.fileIDs != nil {
+		c.fileIDs = fromFile
+	}
+	if len(removed) > 0 {
+		log.Printf("Config reload: removed route(s) %v, no longer in %s", removed, c.routesFile)
+	}
+}
+
+// watch reloads whenever one of the config files changes, until ctx is done.
+func (c *configReloader) watch(ctx context.Context) {
+	paths := []string{c.path}
+	if c.routesFile != c.path {
+		paths = append(paths, c.routesFile)
+	}
+	if err := config.WatchFiles(ctx, paths, 0, c.reload); err != nil && ctx.Err() == nil {
+		log.Printf("WARNING: not watching %v for changes: %v", paths, err)
+	}
+}
+
+// handleSignals reloads on SIGHUP.
+func (c *configReloader) handleSignals() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for range hup {
+		log.Println("Received SIGHUP, reloading configuration.")
+		c.reload()
+	}
+}
@@ -0,0 +1,342 @@
+package config
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	bolt "go.etcd.io/bbolt"
+)
+
+// BoltRouteStore implements RouteStore and HistoryStore in an embedded bbolt
+// database file, for deployments without MongoDB. Records are stored as JSON.
+// Only one process can have the file open at a time.
+type BoltRouteStore struct {
+	db *bolt.DB
+}
+
+var (
+	routesBucket    = []byte("routes")    // route ID -> route
+	historyBucket   = []byte("history")   // route ID, 0, sequence -> change
+	snapshotsBucket = []byte("snapshots") // snapshot ID -> snapshot
+)
+
+// NewBoltRouteStore opens (or creates) the database file. It gives up after a
+// few seconds if another process has the file open.
+func NewBoltRouteStore(cfg *BoltConfig) (*BoltRouteStore, error) {
+	path := cfg.Path
+	if path == "" {
+		path = "gateway.db"
+	}
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("open %s: %w", path, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{routesBucket, historyBucket, snapshotsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &BoltRouteStore{db: db}, nil
+}
+
+// Close closes the database file.
+func (s *BoltRouteStore) Close() error {
+	return s.db.Close()
+}
+
+// LoadRoutes returns all routes, ordered by ID.
+func (s *BoltRouteStore) LoadRoutes() ([]RouteConfig, error) {
+	var routes []RouteConfig
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(routesBucket).ForEach(func(_, v []byte) error {
+			var route RouteConfig
+			if err := json.Unmarshal(v, &route); err != nil {
+				return err
+			}
+			routes = append(routes, route)
+			return nil
+		})
+	})
+	return routes, err
+}
+
+// GetRoute fetches a single route by its ID.
+func (s *BoltRouteStore) GetRoute(id string) (*RouteConfig, error) {
+	var route *RouteConfig
+	err := s.db.View(func(tx *bolt.Tx) error {
+		var err error
+		route, err = getRoute(tx, id)
+		return err
+	})
+	return route, err
+}
+
+// SaveRoute inserts a new route at revision 1, or at route.Revision if that
+// is positive, generating its ID if empty.
+func (s *BoltRouteStore) SaveRoute(route *RouteConfig) error {
+	saved := *route
+	saved.ID = strings.TrimSpace(saved.ID)
+	if saved.ID == "" {
+		saved.ID = uuid.NewString()
+	}
+	if saved.Revision <= 0 {
+		saved.Revision = 1
+	}
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket(routesBucket).Get([]byte(saved.ID)) != nil {
+			return &RouteExistsError{ID: saved.ID}
+		}
+		return putRoute(tx, &saved)
+	})
+	if err != nil {
+		return err
+	}
+	*route = saved
+	return nil
+}
+
+// UpdateRoute replaces the route with the same ID if it is at the expected
+// revision. The check and the write happen in one transaction.
+func (s *BoltRouteStore) UpdateRoute(route *RouteConfig, expected int64) error {
+	updated := *route
+	updated.ID = strings.TrimSpace(updated.ID)
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		current, err := getRoute(tx, updated.ID)
+		if err != nil {
+			return err
+		}
+		if expected != AnyRevision && current.Revision != expected {
+			return &RevisionMismatchError{ID: updated.ID, Expected: expected, Actual: current.Revision}
+		}
+		updated.Revision = current.Revision + 1
+		return putRoute(tx, &updated)
+	})
+	if err != nil {
+		return err
+	}
+	*route = updated
+	return nil
+}
+
+// DeleteRoute removes a route by its ID if it is at the expected revision.
+func (s *BoltRouteStore) DeleteRoute(id string, expected int64) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		current, err := getRoute(tx, id)
+		if err != nil {
+			return err
+		}
+		if expected != AnyRevision && current.Revision != expected {
+			return &RevisionMismatchError{ID: current.ID, Expected: expected, Actual: current.Revision}
+		}
+		return tx.Bucket(routesBucket).Delete([]byte(current.ID))
+	})
+}
+
+func getRoute(tx *bolt.Tx, id string) (*RouteConfig, error) {
+	id = strings.TrimSpace(id)
+	v := tx.Bucket(routesBucket).Get([]byte(id))
+	if v == nil {
+		return nil, &RouteNotFoundError{ID: id}
+	}
+	var route RouteConfig
+	if err := json.Unmarshal(v, &route); err != nil {
+		return nil, err
+	}
+	return &route, nil
+}
+
+func putRoute(tx *bolt.Tx, route *RouteConfig) error {
+	v, err := json.Marshal(route)
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(routesBucket).Put([]byte(route.ID), v)
+}
+
+// RecordChange appends a change to the history. Changes are keyed by route ID
+// and a sequence number, so a route's history is one contiguous range.
+func (s *BoltRouteStore) RecordChange(change *RouteChange) error {
+	if change.ID == "" {
+		change.ID = uuid.NewString()
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return putChange(tx, change)
+	})
+}
+
+func putChange(tx *bolt.Tx, change *RouteChange) error {
+	b := tx.Bucket(historyBucket)
+	seq, err := b.NextSequence()
+	if err != nil {
+		return err
+	}
+	v, err := json.Marshal(change)
+	if err != nil {
+		return err
+	}
+	return b.Put(binary.BigEndian.AppendUint64(historyPrefix(change.RouteID), seq), v)
+}
+
+// RouteHistory returns the changes of a route, newest first.
+func (s *BoltRouteStore) RouteHistory(routeID string) ([]RouteChange, error) {
+	var out []RouteChange
+	err := s.db.View(func(tx *bolt.Tx) error {
+		prefix := historyPrefix(routeID)
+		c := tx.Bucket(historyBucket).Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			var change RouteChange
+			if err := json.Unmarshal(v, &change); err != nil {
+				return err
+			}
+			out = append(out, change)
+		}
+		return nil
+	})
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return out, err
+}
+
+func historyPrefix(routeID string) []byte {
+	return append([]byte(routeID), 0)
+}
+
+// SaveSnapshot stores a snapshot, assigning its ID if empty.
+func (s *BoltRouteStore) SaveSnapshot(snapshot *Snapshot) error {
+	if snapshot.ID == "" {
+		snapshot.ID = uuid.NewString()
+	}
+	v, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(snapshotsBucket).Put([]byte(snapshot.ID), v)
+	})
+}
+
+// ListSnapshots returns all snapshots without their routes, newest first.
+func (s *BoltRouteStore) ListSnapshots() ([]Snapshot, error) {
+	out := []Snapshot{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(snapshotsBucket).ForEach(func(_, v []byte) error {
+			var snap Snapshot
+			if err := json.Unmarshal(v, &snap); err != nil {
+				return err
+			}
+			snap.Routes = nil
+			out = append(out, snap)
+			return nil
+		})
+	})
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Time.After(out[j].Time) })
+	return out, err
+}
+
+// GetSnapshot returns the snapshot with the given ID.
+func (s *BoltRouteStore) GetSnapshot(id string) (*Snapshot, error) {
+	var snap *Snapshot
+	err := s.db.View(func(tx *bolt.Tx) error {
+		v := tx.Bucket(snapshotsBucket).Get([]byte(id))
+		if v == nil {
+			return ErrSnapshotNotFound
+		}
+		snap = &Snapshot{}
+		return json.Unmarshal(v, snap)
+	})
+	return snap, err
+}
+
+// Import copies the routes of src, with their IDs and revisions, into an
+// empty database; if src keeps a history, the routes' changes and all
+// snapshots are copied as well. It does nothing if the database already has
+// routes, so it is safe to leave configured, and returns the number of
+// routes imported.
+func (s *BoltRouteStore) Import(src RouteStore) (int, error) {
+	var empty bool
+	err := s.db.View(func(tx *bolt.Tx) error {
+		k, _ := tx.Bucket(routesBucket).Cursor().First()
+		empty = k == nil
+		return nil
+	})
+	if err != nil || !empty {
+		return 0, err
+	}
+
+	routes, err := src.LoadRoutes()
+	if err != nil {
+		return 0, err
+	}
+	assignIDs(routes)
+
+	var changes []RouteChange
+	var snapshots []Snapshot
+	if history, ok := src.(HistoryStore); ok {
+		for _, route := range routes {
+			routeChanges, err := history.RouteHistory(route.ID)
+			if err != nil {
+				return 0, err
+			}
+			// Oldest first, so the sequence numbers keep the order.
+			for i := len(routeChanges) - 1; i >= 0; i-- {
+				changes = append(changes, routeChanges[i])
+			}
+		}
+		list, err := history.ListSnapshots()
+		if err != nil {
+			return 0, err
+		}
+		for _, snap := range list {
+			full, err := history.GetSnapshot(snap.ID)
+			if err != nil {
+				return 0, err
+			}
+			snapshots = append(snapshots, *full)
+		}
+	}
+
+	// One transaction, so a failed import leaves the database empty and is
+	// retried on the next start.
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		for i := range routes {
+			if err := putRoute(tx, &routes[i]); err != nil {
+				return err
+			}
+		}
+		for i := range changes {
+			if err := putChange(tx, &changes[i]); err != nil {
+				return err
+			}
+		}
+		for _, snap := range snapshots {
+			v, err := json.Marshal(snap)
+			if err != nil {
+				return err
+			}
+			if err := tx.Bucket(snapshotsBucket).Put([]byte(snap.ID), v); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(routes), nil
+}
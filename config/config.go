@@ -1,21 +1,191 @@
 package config
 
 type RouteConfig struct {
-	ID          string   `json:"id,omitempty"			bson:"_id,omitempty"			yaml:"-"` // controlled string id
-	Path        string   `json:"path"        			bson:"path"        				yaml:"path"`
-	Methods     []string `json:"methods"     			bson:"methods"     				yaml:"methods"`
-	Upstream    string   `json:"upstream"    			bson:"upstream"    				yaml:"upstream"`
-	StripPrefix bool     `json:"strip_prefix,omitempty" bson:"strip_prefix,omitempty" 	yaml:"strip_prefix,omitempty"`
-	Plugins     []string `json:"plugins,omitempty"   	bson:"plugins,omitempty"      	yaml:"plugins,omitempty"`
+	ID          string         `json:"id,omitempty" bson:"_id,omitempty" yaml:"id,omitempty"`        // controlled string id
+	Revision    int64          `json:"revision,omitempty" bson:"revision" yaml:"revision,omitempty"` // incremented by the store on every write
+	Path        string         `json:"path" bson:"path" yaml:"path"`
+	Methods     []string       `json:"methods" bson:"methods" yaml:"methods"`
+	Upstream    string         `json:"upstream,omitempty" bson:"upstream,omitempty" yaml:"upstream,omitempty"`
+	Pool        *UpstreamPool  `json:"upstream_pool,omitempty" bson:"upstream_pool,omitempty" yaml:"upstream_pool,omitempty"`
+	StripPrefix bool           `json:"strip_prefix,omitempty" bson:"strip_prefix,omitempty" yaml:"strip_prefix,omitempty"`
+	Plugins     []PluginConfig `json:"plugins,omitempty" bson:"plugins,omitempty" yaml:"plugins,omitempty"`
+	Match       *MatchConfig   `json:"match,omitempty" bson:"match,omitempty" yaml:"match,omitempty"`
+	Priority    int            `json:"priority,omitempty" bson:"priority,omitempty" yaml:"priority,omitempty"` // higher wins among routes matching a request
+	Rewrite     *RewriteConfig `json:"rewrite,omitempty" bson:"rewrite,omitempty" yaml:"rewrite,omitempty"`
+
+	CircuitBreaker *CircuitBreakerConfig `json:"circuit_breaker,omitempty" bson:"circuit_breaker,omitempty" yaml:"circuit_breaker,omitempty"`
+	Retry          *RetryConfig          `json:"retry,omitempty" bson:"retry,omitempty" yaml:"retry,omitempty"`
+	Timeouts       *TimeoutConfig        `json:"timeouts,omitempty" bson:"timeouts,omitempty" yaml:"timeouts,omitempty"`
+}
+
+// RewriteConfig changes the path a route forwards upstream. After
+// strip_prefix, the path template applies, then the regex rules in order,
+// then the base path; the result is joined with the upstream's own path.
+type RewriteConfig struct {
+	Path     string         `json:"path,omitempty" bson:"path,omitempty" yaml:"path,omitempty"`                // e.g. /v2/orders?user={id}; {name} is a path parameter
+	Regex    []RegexRewrite `json:"regex,omitempty" bson:"regex,omitempty" yaml:"regex,omitempty"`             // applied to the path in order
+	BasePath string         `json:"base_path,omitempty" bson:"base_path,omitempty" yaml:"base_path,omitempty"` // prepended to the path
+}
+
+// RegexRewrite replaces every match of a regular expression in the path.
+type RegexRewrite struct {
+	Match   string `json:"match" bson:"match" yaml:"match"`
+	Replace string `json:"replace" bson:"replace" yaml:"replace"` // may refer to groups as $1 or ${name}
+}
+
+// MatchConfig narrows a route to requests with a certain host, headers or
+// query parameters, in addition to its path and methods. All conditions must
+// hold. Routes on the same path are told apart by these.
+type MatchConfig struct {
+	Hosts   []string       `json:"hosts,omitempty" bson:"hosts,omitempty" yaml:"hosts,omitempty"`       // exact, or "*.example.com" for any subdomain; one must match
+	Headers []ValueMatcher `json:"headers,omitempty" bson:"headers,omitempty" yaml:"headers,omitempty"` // all must match
+	Query   []ValueMatcher `json:"query,omitempty" bson:"query,omitempty" yaml:"query,omitempty"`       // all must match
+}
+
+// ValueMatcher checks a request header or query parameter: against an exact
+// Value, a Regex matched against the whole value, or only for presence if
+// neither is set.
+type ValueMatcher struct {
+	Name  string `json:"name" bson:"name" yaml:"name"`
+	Value string `json:"value,omitempty" bson:"value,omitempty" yaml:"value,omitempty"`
+	Regex string `json:"regex,omitempty" bson:"regex,omitempty" yaml:"regex,omitempty"`
+}
+
+// PluginConfig enables a plugin on a route. Config is handed to the plugin's Init
+// and may be omitted, in which case the entry can also be written as a bare name.
+type PluginConfig struct {
+	Name   string                 `json:"name" bson:"name" yaml:"name"`
+	Config map[string]interface{} `json:"config,omitempty" bson:"config,omitempty" yaml:"config,omitempty"`
+}
+
+// UpstreamPool spreads a route's traffic over several upstream targets.
+type UpstreamPool struct {
+	Targets  []UpstreamTarget `json:"targets" bson:"targets" yaml:"targets"`
+	Balancer string           `json:"balancer,omitempty" bson:"balancer,omitempty" yaml:"balancer,omitempty"` // default: round-robin
+	HashOn   string           `json:"hash_on,omitempty" bson:"hash_on,omitempty" yaml:"hash_on,omitempty"`    // consistent-hash only: header, cookie or ip
+	HashKey  string           `json:"hash_key,omitempty" bson:"hash_key,omitempty" yaml:"hash_key,omitempty"` // header or cookie name
+
+	HealthCheck *HealthCheckConfig `json:"health_check,omitempty" bson:"health_check,omitempty" yaml:"health_check,omitempty"`
+}
+
+type UpstreamTarget struct {
+	URL    string `json:"url" bson:"url" yaml:"url"`
+	Weight *int   `json:"weight,omitempty" bson:"weight,omitempty" yaml:"weight,omitempty"` // default: 1, 0 sends no new traffic
+}
+
+// EffectiveWeight returns the target's weight, 1 if none is set.
+func (t UpstreamTarget) EffectiveWeight() int {
+	if t.Weight == nil {
+		return 1
+	}
+	return *t.Weight
+}
+
+// HealthCheckConfig decides which pool targets receive traffic. Active checks
+// probe every target periodically; passive checks watch proxied traffic.
+type HealthCheckConfig struct {
+	Active  *ActiveHealthCheck  `json:"active,omitempty" bson:"active,omitempty" yaml:"active,omitempty"`
+	Passive *PassiveHealthCheck `json:"passive,omitempty" bson:"passive,omitempty" yaml:"passive,omitempty"`
+}
+
+type ActiveHealthCheck struct {
+	Type               string   `json:"type,omitempty" bson:"type,omitempty" yaml:"type,omitempty"`                                              // http (default) or tcp
+	Path               string   `json:"path,omitempty" bson:"path,omitempty" yaml:"path,omitempty"`                                              // http only, default: /
+	Interval           Duration `json:"interval,omitempty" bson:"interval,omitempty" yaml:"interval,omitempty"`                                  // default: 10s
+	Timeout            Duration `json:"timeout,omitempty" bson:"timeout,omitempty" yaml:"timeout,omitempty"`                                     // default: 2s
+	ExpectedStatuses   []int    `json:"expected_statuses,omitempty" bson:"expected_statuses,omitempty" yaml:"expected_statuses,omitempty"`       // default: 200-399
+	HealthyThreshold   int      `json:"healthy_threshold,omitempty" bson:"healthy_threshold,omitempty" yaml:"healthy_threshold,omitempty"`       // default: 2
+	UnhealthyThreshold int      `json:"unhealthy_threshold,omitempty" bson:"unhealthy_threshold,omitempty" yaml:"unhealthy_threshold,omitempty"` // default: 3
+}
+
+type PassiveHealthCheck struct {
+	UnhealthyThreshold int      `json:"unhealthy_threshold,omitempty" bson:"unhealthy_threshold,omitempty" yaml:"unhealthy_threshold,omitempty"` // consecutive failures, default: 5
+	Statuses           []int    `json:"statuses,omitempty" bson:"statuses,omitempty" yaml:"statuses,omitempty"`                                  // failing statuses, default: 500, 502, 503, 504
+	Cooldown           Duration `json:"cooldown,omitempty" bson:"cooldown,omitempty" yaml:"cooldown,omitempty"`                                  // retry an unhealthy target after this long when there is no active check, default: 30s
+}
+
+// CircuitBreakerConfig stops forwarding to a failing upstream for a while.
+// The breaker opens on ConsecutiveFailures or, once MinRequests were seen in
+// the rolling Window, when the failure ratio reaches ErrorRatio.
+type CircuitBreakerConfig struct {
+	ConsecutiveFailures int      `json:"consecutive_failures,omitempty" bson:"consecutive_failures,omitempty" yaml:"consecutive_failures,omitempty"` // default: 5 unless error_ratio is set
+	ErrorRatio          float64  `json:"error_ratio,omitempty" bson:"error_ratio,omitempty" yaml:"error_ratio,omitempty"`                            // 0-1
+	Window              Duration `json:"window,omitempty" bson:"window,omitempty" yaml:"window,omitempty"`                                           // default: 10s
+	MinRequests         int      `json:"min_requests,omitempty" bson:"min_requests,omitempty" yaml:"min_requests,omitempty"`                         // default: 20
+	OpenDuration        Duration `json:"open_duration,omitempty" bson:"open_duration,omitempty" yaml:"open_duration,omitempty"`                      // default: 30s
+	HalfOpenRequests    int      `json:"half_open_requests,omitempty" bson:"half_open_requests,omitempty" yaml:"half_open_requests,omitempty"`       // trial requests, default: 1
+	Statuses            []int    `json:"statuses,omitempty" bson:"statuses,omitempty" yaml:"statuses,omitempty"`                                     // failing statuses, default: 500, 502, 503, 504
+	OpenStatus          int      `json:"open_status,omitempty" bson:"open_status,omitempty" yaml:"open_status,omitempty"`                            // default: 503
+	OpenBody            string   `json:"open_body,omitempty" bson:"open_body,omitempty" yaml:"open_body,omitempty"`                                  // default: "Upstream error: circuit breaker open"
+}
+
+// RetryConfig replays failed requests, preferring a different target each time.
+type RetryConfig struct {
+	Attempts            int      `json:"attempts,omitempty" bson:"attempts,omitempty" yaml:"attempts,omitempty"`                                           // total attempts including the first, default: 3
+	On                  []string `json:"on,omitempty" bson:"on,omitempty" yaml:"on,omitempty"`                                                             // connect-failure, timeout, error; default: connect-failure, timeout
+	Statuses            []int    `json:"statuses,omitempty" bson:"statuses,omitempty" yaml:"statuses,omitempty"`                                           // upstream statuses to retry, default: 502, 503, 504
+	Methods             []string `json:"methods,omitempty" bson:"methods,omitempty" yaml:"methods,omitempty"`                                              // default: GET, HEAD, OPTIONS, PUT, DELETE
+	Backoff             Duration `json:"backoff,omitempty" bson:"backoff,omitempty" yaml:"backoff,omitempty"`                                              // base delay, doubled per retry, default: 25ms
+	MaxBackoff          Duration `json:"max_backoff,omitempty" bson:"max_backoff,omitempty" yaml:"max_backoff,omitempty"`                                  // default: 1s
+	BudgetRatio         float64  `json:"budget_ratio,omitempty" bson:"budget_ratio,omitempty" yaml:"budget_ratio,omitempty"`                               // retries allowed per request, default: 0.2
+	MinRetriesPerSecond int      `json:"min_retries_per_second,omitempty" bson:"min_retries_per_second,omitempty" yaml:"min_retries_per_second,omitempty"` // budget floor, default: 10
+	MaxBodyBytes        int64    `json:"max_body_bytes,omitempty" bson:"max_body_bytes,omitempty" yaml:"max_body_bytes,omitempty"`                         // larger bodies are not retried, default: 1MiB
+}
+
+// TimeoutConfig bounds the time spent on a route's upstream. Zero values fall
+// back to the defaults of Go's http.DefaultTransport (no overall deadline).
+type TimeoutConfig struct {
+	Connect        Duration `json:"connect,omitempty" bson:"connect,omitempty" yaml:"connect,omitempty"`                         // dialing a target
+	TLSHandshake   Duration `json:"tls_handshake,omitempty" bson:"tls_handshake,omitempty" yaml:"tls_handshake,omitempty"`       // TLS handshake with a target
+	ResponseHeader Duration `json:"response_header,omitempty" bson:"response_header,omitempty" yaml:"response_header,omitempty"` // waiting for response headers after the request was sent
+	Idle           Duration `json:"idle,omitempty" bson:"idle,omitempty" yaml:"idle,omitempty"`                                  // keeping idle upstream connections open
+	Request        Duration `json:"request,omitempty" bson:"request,omitempty" yaml:"request,omitempty"`                         // overall deadline including retries
+}
+
+// Targets returns the route's upstream targets: the pool's targets if a pool
+// is configured, otherwise the single Upstream.
+func (r RouteConfig) Targets() []UpstreamTarget {
+	if r.Pool != nil {
+		return r.Pool.Targets
+	}
+	if r.Upstream == "" {
+		return nil
+	}
+	return []UpstreamTarget{{URL: r.Upstream}}
 }
 
 type GatewayConfig struct {
+	Server      ServerConfig      `yaml:"server"`
 	Persistence PersistenceConfig `yaml:"persistence"`
 	Routes      []RouteConfig     `yaml:"routes"`
 }
 
+// ServerConfig configures the gateway's HTTP listener.
+type ServerConfig struct {
+	Address           string   `yaml:"address"`             // default: :8080
+	ReadTimeout       Duration `yaml:"read_timeout"`        // reading the whole request, including the body
+	ReadHeaderTimeout Duration `yaml:"read_header_timeout"` // reading the request headers
+	WriteTimeout      Duration `yaml:"write_timeout"`       // from the end of the request headers to the end of the response
+	IdleTimeout       Duration `yaml:"idle_timeout"`        // keep-alive connections between requests
+}
+
 type PersistenceConfig struct {
 	MongoDB *MongoDBConfig `yaml:"mongodb"`
+	Bolt    *BoltConfig    `yaml:"bolt"`
+	YAML    *YAMLConfig    `yaml:"yaml"`
+}
+
+// BoltConfig configures the route store kept in an embedded bbolt database
+// file. It takes precedence over MongoDB.
+type BoltConfig struct {
+	Path       string `yaml:"path"`        // default: gateway.db
+	ImportFrom string `yaml:"import_from"` // seed an empty database from "mongodb" or "yaml"
+}
+
+// YAMLConfig configures the YAML route store used without MongoDB.
+type YAMLConfig struct {
+	WriteBack  bool   `yaml:"write_back"`  // write route changes to RoutesFile
+	RoutesFile string `yaml:"routes_file"` // default: the config file itself
 }
 
 type MongoDBConfig struct {
@@ -24,4 +194,9 @@ type MongoDBConfig struct {
 	Collection string `yaml:"collection"` // default: routes
 	Username   string `yaml:"username"`   // optional
 	Password   string `yaml:"password"`   // optional
+
+	RateLimitCollection string `yaml:"rate_limit_collection"` // default: ratelimits
+
+	PollInterval   Duration `yaml:"poll_interval"`   // route change polling without change streams, default: 5s
+	ReloadDebounce Duration `yaml:"reload_debounce"` // quiet period before reloading on changes, default: 250ms
 }
@@ -0,0 +1,87 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+)
+
+// Duration is a time.Duration written as a Go duration string ("500ms", "30s")
+// in YAML, JSON and BSON. Plain numbers are read as seconds.
+type Duration time.Duration
+
+// Std returns d as a time.Duration.
+func (d Duration) Std() time.Duration {
+	return time.Duration(d)
+}
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+func (d *Duration) set(v interface{}) error {
+	switch val := v.(type) {
+	case string:
+		parsed, err := time.ParseDuration(val)
+		if err != nil {
+			return err
+		}
+		*d = Duration(parsed)
+	case float64:
+		*d = Duration(val * float64(time.Second))
+	case int:
+		*d = Duration(time.Duration(val) * time.Second)
+	case int32:
+		*d = Duration(time.Duration(val) * time.Second)
+	case int64:
+		*d = Duration(time.Duration(val) * time.Second)
+	default:
+		return fmt.Errorf("invalid duration %v", v)
+	}
+	return nil
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (d *Duration) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var v interface{}
+	if err := unmarshal(&v); err != nil {
+		return err
+	}
+	return d.set(v)
+}
+
+// MarshalYAML implements yaml.Marshaler.
+func (d Duration) MarshalYAML() (interface{}, error) {
+	return d.String(), nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	return d.set(v)
+}
+
+// MarshalJSON implements json.Marshaler.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// UnmarshalBSONValue implements bson.ValueUnmarshaler.
+func (d *Duration) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	var v interface{}
+	if err := (bson.RawValue{Type: t, Value: data}).Unmarshal(&v); err != nil {
+		return err
+	}
+	return d.set(v)
+}
+
+// MarshalBSONValue implements bson.ValueMarshaler.
+func (d Duration) MarshalBSONValue() (bsontype.Type, []byte, error) {
+	return bson.MarshalValue(d.String())
+}
@@ -0,0 +1,112 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+const (
+	defaultFilePollInterval = 2 * time.Second
+	fileChangeSettle        = 100 * time.Millisecond
+)
+
+// WatchFiles calls onChange after any of the given files changes, until ctx is
+// done. Changes are picked up through filesystem notifications, falling back
+// to polling every pollInterval where those are unavailable. Editors often
+// write a file in several steps, so a burst of events causes a single call.
+func WatchFiles(ctx context.Context, paths []string, pollInterval time.Duration, onChange func()) error {
+	if pollInterval <= 0 {
+		pollInterval = defaultFilePollInterval
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err == nil {
+		err = watchDirs(watcher, paths)
+		if err != nil {
+			watcher.Close()
+		}
+	}
+	if err != nil {
+		log.Printf("File notifications unavailable, polling config every %v: %v", pollInterval, err)
+		return pollFiles(ctx, paths, pollInterval, onChange)
+	}
+	defer watcher.Close()
+
+	// Watch the directories rather than the files, so files replaced by a
+	// rename (as editors and our own atomic writes do) are still followed.
+	watched := map[string]bool{}
+	for _, path := range paths {
+		watched[filepath.Clean(path)] = true
+	}
+	var settle <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if watched[filepath.Clean(event.Name)] && !event.Has(fsnotify.Chmod) {
+				settle = time.After(fileChangeSettle)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			log.Printf("Watching config files: %v", err)
+		case <-settle:
+			settle = nil
+			onChange()
+		}
+	}
+}
+
+func watchDirs(watcher *fsnotify.Watcher, paths []string) error {
+	dirs := map[string]bool{}
+	for _, path := range paths {
+		dir := filepath.Dir(path)
+		if dirs[dir] {
+			continue
+		}
+		dirs[dir] = true
+		if err := watcher.Add(dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pollFiles compares the contents of the files every interval.
+func pollFiles(ctx context.Context, paths []string, interval time.Duration, onChange func()) error {
+	read := func() [][]byte {
+		out := make([][]byte, len(paths))
+		for i, path := range paths {
+			out[i], _ = os.ReadFile(path)
+		}
+		return out
+	}
+	last := read()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		current := read()
+		for i := range current {
+			if !bytes.Equal(current[i], last[i]) {
+				last = current
+				onChange()
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package config
+
+import (
+	"errors"
+	"time"
+)
+
+// Actions recorded in the route history.
+const (
+	ActionCreate   = "create"
+	ActionUpdate   = "update"
+	ActionDelete   = "delete"
+	ActionRollback = "rollback"
+	ActionRestore  = "restore"
+)
+
+// RouteChange is an immutable record of one write to a route.
+type RouteChange struct {
+	ID       string        `json:"id" bson:"_id"`
+	RouteID  string        `json:"route_id" bson:"route_id"`
+	Revision int64         `json:"revision" bson:"revision"` // revision written, or deleted for ActionDelete
+	Action   string        `json:"action" bson:"action"`
+	Actor    string        `json:"actor,omitempty" bson:"actor,omitempty"`
+	Time     time.Time     `json:"time" bson:"time"`
+	Before   *RouteConfig  `json:"before,omitempty" bson:"before,omitempty"`
+	After    *RouteConfig  `json:"after,omitempty" bson:"after,omitempty"`
+	Diff     []FieldChange `json:"diff,omitempty" bson:"diff,omitempty"`
+}
+
+// FieldChange is one changed field of a route, named by its dotted JSON path.
+type FieldChange struct {
+	Field  string      `json:"field" bson:"field"`
+	Before interface{} `json:"before,omitempty" bson:"before,omitempty"`
+	After  interface{} `json:"after,omitempty" bson:"after,omitempty"`
+}
+
+// Snapshot is a copy of every route at one point in time.
+type Snapshot struct {
+	ID     string        `json:"id" bson:"_id"`
+	Time   time.Time     `json:"time" bson:"time"`
+	Actor  string        `json:"actor,omitempty" bson:"actor,omitempty"`
+	Note   string        `json:"note,omitempty" bson:"note,omitempty"`
+	Routes []RouteConfig `json:"routes,omitempty" bson:"routes"`
+}
+
+// HistoryStore is implemented by route stores that keep a change history and
+// snapshots next to the routes.
+type HistoryStore interface {
+	// RecordChange appends a change, assigning its ID if empty.
+	RecordChange(change *RouteChange) error
+	// RouteHistory returns the changes of a route, newest first.
+	RouteHistory(routeID string) ([]RouteChange, error)
+	// SaveSnapshot stores a snapshot, assigning its ID if empty.
+	SaveSnapshot(snapshot *Snapshot) error
+	// ListSnapshots returns all snapshots without their routes, newest first.
+	ListSnapshots() ([]Snapshot, error)
+	GetSnapshot(id string) (*Snapshot, error)
+}
+
+// ErrSnapshotNotFound is returned by GetSnapshot for an unknown ID.
+var ErrSnapshotNotFound = errors.New("snapshot not found")
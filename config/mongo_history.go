@@ -0,0 +1,94 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// RecordChange inserts a change into the history collection
+func (m *MongoRouteStore) RecordChange(change *RouteChange) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if change.ID == "" {
+		change.ID = uuid.NewString()
+	}
+	_, err := m.history.InsertOne(ctx, change)
+	return err
+}
+
+// RouteHistory fetches the changes of a route, newest first
+func (m *MongoRouteStore) RouteHistory(routeID string) ([]RouteChange, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "time", Value: -1}})
+	cursor, err := m.history.Find(ctx, bson.M{"route_id": routeID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	var changes []RouteChange
+	if err := cursor.All(ctx, &changes); err != nil {
+		return nil, err
+	}
+	for i := range changes {
+		for j := range changes[i].Diff {
+			diff := &changes[i].Diff[j]
+			diff.Before, diff.After = normalizeValue(diff.Before), normalizeValue(diff.After)
+		}
+	}
+	return changes, nil
+}
+
+// SaveSnapshot inserts a snapshot of all routes
+func (m *MongoRouteStore) SaveSnapshot(snapshot *Snapshot) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if snapshot.ID == "" {
+		snapshot.ID = uuid.NewString()
+	}
+	_, err := m.snapshots.InsertOne(ctx, snapshot)
+	return err
+}
+
+// ListSnapshots fetches all snapshots without their routes, newest first
+func (m *MongoRouteStore) ListSnapshots() ([]Snapshot, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "time", Value: -1}}).
+		SetProjection(bson.M{"routes": 0})
+	cursor, err := m.snapshots.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, err
+	}
+	snapshots := []Snapshot{}
+	if err := cursor.All(ctx, &snapshots); err != nil {
+		return nil, err
+	}
+	return snapshots, nil
+}
+
+// GetSnapshot fetches a snapshot by its ID
+func (m *MongoRouteStore) GetSnapshot(id string) (*Snapshot, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var snapshot Snapshot
+	err := m.snapshots.FindOne(ctx, bson.M{"_id": id}).Decode(&snapshot)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, ErrSnapshotNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
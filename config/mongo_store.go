@@ -16,6 +16,10 @@ import (
 type MongoRouteStore struct {
 	client     *mongo.Client
 	collection *mongo.Collection
+	history    *mongo.Collection // <collection>_history
+	snapshots  *mongo.Collection // <collection>_snapshots
+
+	pollInterval time.Duration
 }
 
 // NewMongoRouteStore creates a RouteStore backed by MongoDB
@@ -52,13 +56,38 @@ func NewMongoRouteStore(cfg *MongoDBConfig) (RouteStore, error) {
 		collName = "routes"
 	}
 
-	collection := client.Database(dbName).Collection(collName)
+	db := client.Database(dbName)
+	history := db.Collection(collName + "_history")
+	_, err = history.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "route_id", Value: 1}, {Key: "time", Value: -1}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
 	return &MongoRouteStore{
 		client:     client,
-		collection: collection,
+		collection: db.Collection(collName),
+		history:    history,
+		snapshots:  db.Collection(collName + "_snapshots"),
+
+		pollInterval: cfg.PollInterval.Std(),
 	}, nil
 }
 
+// Database returns the database holding the routes collection, so other
+// shared state can be kept next to it.
+func (m *MongoRouteStore) Database() *mongo.Database {
+	return m.collection.Database()
+}
+
+// Close disconnects from MongoDB.
+func (m *MongoRouteStore) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return m.client.Disconnect(ctx)
+}
+
 // LoadRoutes fetches all route documents from MongoDB
 func (m *MongoRouteStore) LoadRoutes() ([]RouteConfig, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -90,41 +119,152 @@ func (m *MongoRouteStore) SaveRoute(route *RouteConfig) error {
 	if route.ID == "" {
 		route.ID = uuid.NewString()
 	}
+	if route.Revision <= 0 {
+		route.Revision = 1
+	}
 
 	_, err := m.collection.InsertOne(ctx, route)
+	if mongo.IsDuplicateKeyError(err) {
+		return &RouteExistsError{ID: route.ID}
+	}
 	return err
 }
 
-// DeleteRoute removes a route by its ID from MongoDB
-func (m *MongoRouteStore) DeleteRoute(id string) error {
+// GetRoute fetches a single route by its ID
+func (m *MongoRouteStore) GetRoute(id string) (*RouteConfig, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	// Normalize
-	id = strings.TrimSpace(id)
+	for _, filter := range idFilters(id) {
+		var route RouteConfig
+		err := m.collection.FindOne(ctx, filter).Decode(&route)
+		if err == nil {
+			route.ID = strings.TrimSpace(id)
+			return &route, nil
+		}
+		if !errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, err
+		}
+	}
+	return nil, &RouteNotFoundError{ID: id}
+}
 
-	// 1) Preferred: _id is a string UUID
-	if res, err := m.collection.DeleteOne(ctx, bson.M{"_id": id}); err != nil {
+// UpdateRoute replaces the route with the same ID if it is at the expected
+// revision. The check and the revision increment happen in a single
+// conditional update. Legacy documents, matched by an "id" field or an
+// ObjectId, are rewritten with the string _id.
+func (m *MongoRouteStore) UpdateRoute(route *RouteConfig, expected int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	filters := idFilters(route.ID)
+	route.ID = strings.TrimSpace(route.ID)
+	doc, err := bson.Marshal(route)
+	if err != nil {
 		return err
-	} else if res.DeletedCount > 0 {
+	}
+
+	// Replace the document and bump the stored revision in one step; the
+	// replacement is wrapped in $literal so values starting with "$" are
+	// not read as expressions.
+	update := mongo.Pipeline{{{Key: "$replaceWith", Value: bson.M{
+		"$mergeObjects": bson.A{
+			bson.M{"$literal": bson.Raw(doc)},
+			bson.M{"revision": bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$revision", 0}}, 1}}},
+		},
+	}}}}
+	var stored RouteConfig
+	err = m.collection.FindOneAndUpdate(ctx,
+		withRevision(filters[0], expected),
+		update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&stored)
+	if err == nil {
+		route.Revision = stored.Revision
 		return nil
 	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return err
+	}
 
-	// 2) Legacy: separate "id" field (older documents)
-	if res, err := m.collection.DeleteOne(ctx, bson.M{"id": id}); err != nil {
+	for _, filter := range filters {
+		var current RouteConfig
+		if err := m.collection.FindOne(ctx, filter).Decode(&current); errors.Is(err, mongo.ErrNoDocuments) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if expected != AnyRevision && current.Revision != expected {
+			return &RevisionMismatchError{ID: route.ID, Expected: expected, Actual: current.Revision}
+		}
+		if filter["_id"] == route.ID {
+			// Changed between the update and the read above.
+			return &RevisionMismatchError{ID: route.ID, Expected: expected, Actual: current.Revision}
+		}
+		route.Revision = current.Revision + 1
+		if _, err := m.collection.InsertOne(ctx, route); err != nil {
+			return err
+		}
+		_, err := m.collection.DeleteOne(ctx, filter)
 		return err
-	} else if res.DeletedCount > 0 {
-		return nil
 	}
+	return &RouteNotFoundError{ID: route.ID}
+}
 
-	// 3) Very old: _id is an ObjectId
-	if oid, err := primitive.ObjectIDFromHex(id); err == nil {
-		if res, err := m.collection.DeleteOne(ctx, bson.M{"_id": oid}); err != nil {
+// DeleteRoute removes a route by its ID from MongoDB if it is at the
+// expected revision.
+func (m *MongoRouteStore) DeleteRoute(id string, expected int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for _, filter := range idFilters(id) {
+		if res, err := m.collection.DeleteOne(ctx, withRevision(filter, expected)); err != nil {
 			return err
 		} else if res.DeletedCount > 0 {
 			return nil
 		}
 	}
 
-	return errors.New("route not found")
+	if expected != AnyRevision {
+		if current, err := m.GetRoute(id); err == nil {
+			return &RevisionMismatchError{ID: current.ID, Expected: expected, Actual: current.Revision}
+		}
+	}
+	return &RouteNotFoundError{ID: id}
+}
+
+// withRevision adds the revision condition of a conditional write to filter.
+// Documents written before revisions existed are at revision 0.
+func withRevision(filter bson.M, expected int64) bson.M {
+	if expected == AnyRevision {
+		return filter
+	}
+	out := bson.M{}
+	for k, v := range filter {
+		out[k] = v
+	}
+	if expected == 0 {
+		out["revision"] = bson.M{"$in": bson.A{0, nil}}
+	} else {
+		out["revision"] = expected
+	}
+	return out
+}
+
+// idFilters returns the filters matching a route ID, in order of preference.
+func idFilters(id string) []bson.M {
+	// Normalize
+	id = strings.TrimSpace(id)
+
+	filters := []bson.M{
+		// 1) Preferred: _id is a string UUID
+		{"_id": id},
+		// 2) Legacy: separate "id" field (older documents)
+		{"id": id},
+	}
+	// 3) Very old: _id is an ObjectId
+	if oid, err := primitive.ObjectIDFromHex(id); err == nil {
+		filters = append(filters, bson.M{"_id": oid})
+	}
+	return filters
 }
@@ -0,0 +1,155 @@
+package config
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	defaultPollInterval = 5 * time.Second
+	maxWatchBackoff     = 30 * time.Second
+
+	// Server error codes
+	codeChangeStreamsUnsupported = 40573 // not a replica set or sharded cluster
+	codeChangeStreamHistoryLost  = 286   // resume token no longer in the oplog
+	codeChangeStreamFatal        = 280
+)
+
+// Watch follows the routes collection with a change stream and calls
+// onChange for every change. After a disconnect the stream resumes from the
+// last seen event; whenever it has to start without one, e.g. on the first
+// open or when the resume point has left the oplog, it calls onChange once,
+// as changes may have been missed. Standalone servers have no change
+// streams, so the collection is polled instead.
+func (m *MongoRouteStore) Watch(ctx context.Context, onChange func()) error {
+	var token bson.Raw
+	backoff := time.Second
+	for {
+		missed := token == nil
+		err := m.watchStream(ctx, &token, func() {
+			backoff = time.Second
+			if missed {
+				onChange()
+			}
+		}, onChange)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		var serverErr mongo.ServerError
+		if errors.As(err, &serverErr) {
+			switch {
+			case serverErr.HasErrorCode(codeChangeStreamsUnsupported):
+				log.Printf("MongoDB change streams unavailable, polling routes every %v", m.pollEvery())
+				return m.poll(ctx, onChange)
+			case serverErr.HasErrorCode(codeChangeStreamHistoryLost), serverErr.HasErrorCode(codeChangeStreamFatal):
+				token = nil
+			}
+		}
+		log.Printf("Route change stream interrupted, reopening in %v: %v", backoff, err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > maxWatchBackoff {
+			backoff = maxWatchBackoff
+		}
+	}
+}
+
+// watchStream runs one change stream until it fails, keeping token at the
+// last event seen. started is called once the stream is open.
+func (m *MongoRouteStore) watchStream(ctx context.Context, token *bson.Raw, started, onChange func()) error {
+	opts := options.ChangeStream()
+	if *token != nil {
+		opts.SetResumeAfter(*token)
+	}
+	stream, err := m.collection.Watch(ctx, mongo.Pipeline{}, opts)
+	if err != nil {
+		return err
+	}
+	defer stream.Close(context.Background())
+	started()
+
+	for stream.Next(ctx) {
+		*token = stream.ResumeToken()
+		var event struct {
+			OperationType string `bson:"operationType"`
+		}
+		if err := stream.Decode(&event); err == nil && event.OperationType == "invalidate" {
+			// The collection was dropped or renamed; the stream cannot resume.
+			*token = nil
+			onChange()
+			return errors.New("change stream invalidated")
+		}
+		onChange()
+	}
+	if err := stream.Err(); err != nil {
+		return err
+	}
+	return errors.New("change stream closed")
+}
+
+func (m *MongoRouteStore) pollEvery() time.Duration {
+	if m.pollInterval > 0 {
+		return m.pollInterval
+	}
+	return defaultPollInterval
+}
+
+// poll compares a fingerprint of the route documents every poll interval and
+// calls onChange when it differs.
+func (m *MongoRouteStore) poll(ctx context.Context, onChange func()) error {
+	last, err := m.fingerprint(ctx)
+	if err != nil {
+		log.Printf("Polling routes: %v", err)
+	}
+	ticker := time.NewTicker(m.pollEvery())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		current, err := m.fingerprint(ctx)
+		if err != nil {
+			log.Printf("Polling routes: %v", err)
+			continue
+		}
+		if current != last {
+			last = current
+			onChange()
+		}
+	}
+}
+
+func (m *MongoRouteStore) fingerprint(ctx context.Context) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}})
+	cursor, err := m.collection.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return "", err
+	}
+	defer cursor.Close(ctx)
+
+	h := sha256.New()
+	for cursor.Next(ctx) {
+		h.Write(cursor.Current)
+	}
+	if err := cursor.Err(); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
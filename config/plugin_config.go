@@ -0,0 +1,124 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// pluginConfigFields has the same shape as PluginConfig without its custom
+// unmarshalers, so the methods below can decode into it without recursing.
+type pluginConfigFields PluginConfig
+
+// UnmarshalYAML accepts either a bare plugin name or a {name, config} mapping.
+func (p *PluginConfig) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var name string
+	if err := unmarshal(&name); err == nil {
+		*p = PluginConfig{Name: name}
+		return nil
+	}
+
+	var fields pluginConfigFields
+	if err := unmarshal(&fields); err != nil {
+		return err
+	}
+	fields.Config = normalizeMap(fields.Config)
+	*p = PluginConfig(fields)
+	return nil
+}
+
+// MarshalYAML writes an entry without config as a bare plugin name.
+func (p PluginConfig) MarshalYAML() (interface{}, error) {
+	if len(p.Config) == 0 {
+		return p.Name, nil
+	}
+	return pluginConfigFields(p), nil
+}
+
+// UnmarshalJSON accepts either a bare plugin name or a {name, config} object.
+func (p *PluginConfig) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		*p = PluginConfig{Name: name}
+		return nil
+	}
+
+	var fields pluginConfigFields
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	*p = PluginConfig(fields)
+	return nil
+}
+
+// UnmarshalBSONValue accepts either a bare plugin name, as stored by older
+// gateway versions, or an embedded {name, config} document.
+func (p *PluginConfig) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	switch t {
+	case bsontype.String:
+		name, ok := bson.RawValue{Type: t, Value: data}.StringValueOK()
+		if !ok {
+			return fmt.Errorf("invalid plugin name")
+		}
+		*p = PluginConfig{Name: name}
+		return nil
+	case bsontype.EmbeddedDocument:
+		var fields pluginConfigFields
+		if err := bson.Unmarshal(data, &fields); err != nil {
+			return err
+		}
+		fields.Config = normalizeMap(fields.Config)
+		*p = PluginConfig(fields)
+		return nil
+	default:
+		return fmt.Errorf("cannot decode plugin entry from BSON %s", t)
+	}
+}
+
+// normalizeMap converts the nested map and array types produced by the YAML and
+// BSON decoders into map[string]interface{} and []interface{}, so plugins see
+// the same shapes regardless of where their config came from.
+func normalizeMap(m map[string]interface{}) map[string]interface{} {
+	if m == nil {
+		return nil
+	}
+	out := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		out[k] = normalizeValue(v)
+	}
+	return out
+}
+
+func normalizeValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		return normalizeMap(val)
+	case map[interface{}]interface{}:
+		out := make(map[string]interface{}, len(val))
+		for k, item := range val {
+			out[fmt.Sprint(k)] = normalizeValue(item)
+		}
+		return out
+	case primitive.M:
+		return normalizeMap(val)
+	case primitive.D:
+		out := make(map[string]interface{}, len(val))
+		for _, elem := range val {
+			out[elem.Key] = normalizeValue(elem.Value)
+		}
+		return out
+	case primitive.A:
+		return normalizeValue([]interface{}(val))
+	case []interface{}:
+		out := make([]interface{}, len(val))
+		for i, item := range val {
+			out[i] = normalizeValue(item)
+		}
+		return out
+	default:
+		return v
+	}
+}
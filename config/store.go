@@ -1,7 +1,91 @@
 package config
 
+import (
+	"context"
+	"fmt"
+)
+
+// RouteStore persists routes. Every write increments the route's Revision;
+// UpdateRoute and DeleteRoute only apply if the stored revision equals
+// expected, unless expected is AnyRevision, and otherwise fail with a
+// RevisionMismatchError. SaveRoute fails with a RouteExistsError if the ID is
+// taken, and otherwise stores a new route at revision 1, or at
+// route.Revision if that is positive, so a recreated route can continue the
+// revisions of the one it replaces.
 type RouteStore interface {
 	LoadRoutes() ([]RouteConfig, error)
+	GetRoute(id string) (*RouteConfig, error)
 	SaveRoute(route *RouteConfig) error
-	DeleteRoute(id string) error
+	UpdateRoute(route *RouteConfig, expected int64) error
+	DeleteRoute(id string, expected int64) error
+}
+
+// AnyRevision makes UpdateRoute and DeleteRoute apply regardless of the
+// stored revision.
+const AnyRevision int64 = -1
+
+// RouteNotFoundError is returned by a RouteStore when no route has the given ID.
+type RouteNotFoundError struct {
+	ID string
+}
+
+func (e *RouteNotFoundError) Error() string {
+	return fmt.Sprintf("route %q not found", e.ID)
+}
+
+// Is makes every RouteNotFoundError match ErrRouteNotFound in errors.Is.
+func (e *RouteNotFoundError) Is(target error) bool {
+	_, ok := target.(*RouteNotFoundError)
+	return ok
+}
+
+// ErrRouteNotFound can be used with errors.Is to detect a missing route.
+var ErrRouteNotFound error = &RouteNotFoundError{}
+
+// RouteExistsError is returned by SaveRoute when a route with the ID is
+// already stored.
+type RouteExistsError struct {
+	ID string
+}
+
+func (e *RouteExistsError) Error() string {
+	return fmt.Sprintf("route %q already exists", e.ID)
+}
+
+// Is makes every RouteExistsError match ErrRouteExists in errors.Is.
+func (e *RouteExistsError) Is(target error) bool {
+	_, ok := target.(*RouteExistsError)
+	return ok
+}
+
+// ErrRouteExists can be used with errors.Is to detect a duplicate route ID.
+var ErrRouteExists error = &RouteExistsError{}
+
+// RevisionMismatchError is returned by a conditional write when the stored
+// route has changed since the expected revision was read.
+type RevisionMismatchError struct {
+	ID       string
+	Expected int64
+	Actual   int64
+}
+
+func (e *RevisionMismatchError) Error() string {
+	return fmt.Sprintf("route %q is at revision %d, not %d", e.ID, e.Actual, e.Expected)
+}
+
+// Is makes every RevisionMismatchError match ErrRevisionMismatch in errors.Is.
+func (e *RevisionMismatchError) Is(target error) bool {
+	_, ok := target.(*RevisionMismatchError)
+	return ok
+}
+
+// ErrRevisionMismatch can be used with errors.Is to detect a failed conditional write.
+var ErrRevisionMismatch error = &RevisionMismatchError{}
+
+// RouteWatcher is implemented by route stores that can report changes made
+// by other gateway instances.
+type RouteWatcher interface {
+	// Watch calls onChange after the stored routes change, until ctx is done.
+	// Calls may be spurious or cover several changes.
+	Watch(ctx context.Context, onChange func()) error
 }
@@ -0,0 +1,141 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v2"
+	yamlv3 "gopkg.in/yaml.v3"
+)
+
+// NewYAMLFileRouteStore creates a YAMLRouteStore that writes every change to
+// the routes section of the YAML file at path. If the file already has a
+// routes section the routes are loaded from it, otherwise the given routes
+// are used. Generated IDs are written right away, so they stay stable across
+// restarts.
+func NewYAMLFileRouteStore(path string, routes []RouteConfig) (*YAMLRouteStore, error) {
+	fileRoutes, found, err := ReadRoutesFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if found {
+		routes = fileRoutes
+	}
+
+	s := &YAMLRouteStore{path: path}
+	if assignIDs(routes) || !found {
+		if err := s.commit(routes); err != nil {
+			return nil, err
+		}
+	}
+	s.routes = routes
+	return s, nil
+}
+
+// ReadRoutesFile reads the routes section of the YAML file at path. found is
+// false if the file does not exist or has no routes section.
+func ReadRoutesFile(path string) (routes []RouteConfig, found bool, err error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	var file struct {
+		Routes *[]RouteConfig `yaml:"routes"`
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, false, fmt.Errorf("%s: %w", path, err)
+	}
+	if file.Routes == nil {
+		return nil, false, nil
+	}
+	return *file.Routes, true, nil
+}
+
+// writeRoutesFile replaces the routes section of the YAML file at path,
+// keeping the rest of the document and its comments as they are. The file
+// is replaced atomically, so a crash never leaves it half written.
+func writeRoutesFile(path string, routes []RouteConfig) error {
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	var doc yamlv3.Node
+	if err := yamlv3.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if len(doc.Content) == 0 {
+		doc = yamlv3.Node{Kind: yamlv3.DocumentNode, Content: []*yamlv3.Node{{Kind: yamlv3.MappingNode, Tag: "!!map"}}}
+	}
+	root := doc.Content[0]
+	if root.Kind != yamlv3.MappingNode {
+		return fmt.Errorf("%s: top level is not a mapping", path)
+	}
+
+	if routes == nil {
+		routes = []RouteConfig{}
+	}
+	var value yamlv3.Node
+	if err := value.Encode(routes); err != nil {
+		return err
+	}
+	replaced := false
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value == "routes" {
+			root.Content[i+1] = &value
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		key := &yamlv3.Node{Kind: yamlv3.ScalarNode, Tag: "!!str", Value: "routes"}
+		root.Content = append(root.Content, key, &value)
+	}
+
+	var buf bytes.Buffer
+	enc := yamlv3.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return err
+	}
+	if err := enc.Close(); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, buf.Bytes())
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames
+// it over path, keeping the permissions of an existing file.
+func writeFileAtomic(path string, data []byte) error {
+	mode := os.FileMode(0o644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op after a successful rename
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -1,25 +1,52 @@
 package config
 
 import (
-	"errors"
+	"bytes"
+	"reflect"
+	"sort"
 	"sync"
 
 	"github.com/google/uuid"
+	"gopkg.in/yaml.v2"
 )
 
 // YAMLRouteStore implements RouteStore using in-memory route definitions loaded from config.yaml.
+// If created with NewYAMLFileRouteStore, every change is also written to a file.
 type YAMLRouteStore struct {
-	mu     sync.RWMutex
-	routes []RouteConfig
+	mu        sync.RWMutex
+	routes    []RouteConfig
+	path      string // file the routes are written to, empty to keep them in memory
+	history   []RouteChange
+	snapshots []Snapshot
 }
 
 // NewYAMLRouteStore creates a new store backed by in-memory routes.
+// Routes without an ID get a generated one, so they can be addressed through
+// the admin API.
 func NewYAMLRouteStore(routes []RouteConfig) *YAMLRouteStore {
+	assignIDs(routes)
 	return &YAMLRouteStore{
 		routes: routes,
 	}
 }
 
+// assignIDs gives routes without an ID a new one and starts unversioned routes
+// at revision 1. It reports whether any route changed.
+func assignIDs(routes []RouteConfig) bool {
+	changed := false
+	for i := range routes {
+		if routes[i].ID == "" {
+			routes[i].ID = uuid.NewString()
+			changed = true
+		}
+		if routes[i].Revision == 0 {
+			routes[i].Revision = 1
+			changed = true
+		}
+	}
+	return changed
+}
+
 // LoadRoutes returns the current set of routes.
 func (s *YAMLRouteStore) LoadRoutes() ([]RouteConfig, error) {
 	s.mu.RLock()
@@ -29,7 +56,21 @@ func (s *YAMLRouteStore) LoadRoutes() ([]RouteConfig, error) {
 	return out, nil
 }
 
-// SaveRoute appends a new route to the in-memory list.
+// GetRoute returns the route with the given ID.
+func (s *YAMLRouteStore) GetRoute(id string) (*RouteConfig, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, r := range s.routes {
+		if r.ID == id {
+			return &r, nil
+		}
+	}
+	return nil, &RouteNotFoundError{ID: id}
+}
+
+// SaveRoute appends a new route to the in-memory list, at revision 1 unless
+// route.Revision is already positive.
 func (s *YAMLRouteStore) SaveRoute(route *RouteConfig) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -37,20 +78,229 @@ func (s *YAMLRouteStore) SaveRoute(route *RouteConfig) error {
 	if route.ID == "" {
 		route.ID = uuid.NewString()
 	}
-	s.routes = append(s.routes, *route)
-	return nil
+	for _, r := range s.routes {
+		if r.ID == route.ID {
+			return &RouteExistsError{ID: route.ID}
+		}
+	}
+	if route.Revision <= 0 {
+		route.Revision = 1
+	}
+	return s.commit(append(s.clone(), *route))
 }
 
-// DeleteRoute removes a route by its ID.
-func (s *YAMLRouteStore) DeleteRoute(id string) error {
+// UpdateRoute replaces the route with the same ID if it is at the expected revision.
+func (s *YAMLRouteStore) UpdateRoute(route *RouteConfig, expected int64) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	for i, r := range s.routes {
-		if r.ID == id {
-			s.routes = append(s.routes[:i], s.routes[i+1:]...)
+		if r.ID == route.ID {
+			if expected != AnyRevision && r.Revision != expected {
+				return &RevisionMismatchError{ID: r.ID, Expected: expected, Actual: r.Revision}
+			}
+			updated := *route
+			updated.Revision = r.Revision + 1
+			routes := s.clone()
+			routes[i] = updated
+			if err := s.commit(routes); err != nil {
+				return err
+			}
+			route.Revision = updated.Revision
 			return nil
 		}
 	}
-	return errors.New("route not found")
+	return &RouteNotFoundError{ID: route.ID}
+}
+
+// DeleteRoute removes a route by its ID if it is at the expected revision.
+func (s *YAMLRouteStore) DeleteRoute(id string, expected int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, r := range s.routes {
+		if r.ID == id {
+			if expected != AnyRevision && r.Revision != expected {
+				return &RevisionMismatchError{ID: id, Expected: expected, Actual: r.Revision}
+			}
+			routes := s.clone()
+			return s.commit(append(routes[:i], routes[i+1:]...))
+		}
+	}
+	return &RouteNotFoundError{ID: id}
+}
+
+// Resolve prepares routes read from the config file to replace the current
+// ones: routes without an ID take over the ID of the current route with the
+// same path and methods, so IDs stay stable across edits, and routes that
+// changed get a new revision. The store itself is not changed.
+func (s *YAMLRouteStore) Resolve(routes []RouteConfig) []RouteConfig {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	routes = append([]RouteConfig(nil), routes...)
+	taken := map[string]bool{}
+	for i := range routes {
+		route := &routes[i]
+		current := s.match(route, taken)
+		if current == nil {
+			continue
+		}
+		taken[current.ID] = true
+		route.ID = current.ID
+		if route.Revision <= current.Revision {
+			unchanged := *route
+			unchanged.Revision = current.Revision
+			if sameRoute(unchanged, *current) {
+				route.Revision = current.Revision
+			} else {
+				route.Revision = current.Revision + 1
+			}
+		}
+	}
+	assignIDs(routes)
+	return routes
+}
+
+// ReplaceRoutes swaps in a new set of routes, usually prepared by Resolve.
+// A file-backed store writes them only if the file does not already hold
+// the same IDs and revisions, so reloading after its own write settles.
+func (s *YAMLRouteStore) ReplaceRoutes(routes []RouteConfig) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.path != "" {
+		fileRoutes, _, err := ReadRoutesFile(s.path)
+		if err != nil || !sameVersions(fileRoutes, routes) {
+			return s.commit(routes)
+		}
+	}
+	s.routes = routes
+	return nil
+}
+
+// sameRoute compares routes in their YAML form. Routes written through the
+// admin API carry JSON decoded plugin configs, where numbers are float64,
+// while the same routes read back from the file hold ints.
+func sameRoute(a, b RouteConfig) bool {
+	ya, errA := yaml.Marshal(a)
+	yb, errB := yaml.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(ya, yb)
+}
+
+func sameVersions(a, b []RouteConfig) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].ID != b[i].ID || a[i].Revision != b[i].Revision {
+			return false
+		}
+	}
+	return true
+}
+
+// match returns the current route a route from the config file replaces: the
+// one with its ID or, for a route without ID, the first one not yet taken
+// with its path and methods.
+func (s *YAMLRouteStore) match(route *RouteConfig, taken map[string]bool) *RouteConfig {
+	for i := range s.routes {
+		r := &s.routes[i]
+		if taken[r.ID] {
+			continue
+		}
+		if route.ID != "" && r.ID == route.ID {
+			return r
+		}
+		if route.ID == "" && r.Path == route.Path && reflect.DeepEqual(r.Methods, route.Methods) {
+			return r
+		}
+	}
+	return nil
+}
+
+// clone returns a copy of the routes to build a changed set from. The caller
+// must hold s.mu.
+func (s *YAMLRouteStore) clone() []RouteConfig {
+	out := make([]RouteConfig, len(s.routes))
+	copy(out, s.routes)
+	return out
+}
+
+// commit makes routes the current set, after writing them to the store's
+// file if it has one. If the write fails nothing changes. The caller must
+// hold s.mu for writing.
+func (s *YAMLRouteStore) commit(routes []RouteConfig) error {
+	if s.path != "" {
+		if err := writeRoutesFile(s.path, routes); err != nil {
+			return err
+		}
+	}
+	s.routes = routes
+	return nil
+}
+
+// RecordChange appends a change to the in-memory history.
+func (s *YAMLRouteStore) RecordChange(change *RouteChange) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if change.ID == "" {
+		change.ID = uuid.NewString()
+	}
+	s.history = append(s.history, *change)
+	return nil
+}
+
+// RouteHistory returns the changes of a route, newest first.
+func (s *YAMLRouteStore) RouteHistory(routeID string) ([]RouteChange, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var out []RouteChange
+	for i := len(s.history) - 1; i >= 0; i-- {
+		if s.history[i].RouteID == routeID {
+			out = append(out, s.history[i])
+		}
+	}
+	return out, nil
+}
+
+// SaveSnapshot keeps a snapshot in memory.
+func (s *YAMLRouteStore) SaveSnapshot(snapshot *Snapshot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if snapshot.ID == "" {
+		snapshot.ID = uuid.NewString()
+	}
+	s.snapshots = append(s.snapshots, *snapshot)
+	return nil
+}
+
+// ListSnapshots returns all snapshots without their routes, newest first.
+func (s *YAMLRouteStore) ListSnapshots() ([]Snapshot, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	out := make([]Snapshot, 0, len(s.snapshots))
+	for _, snap := range s.snapshots {
+		snap.Routes = nil
+		out = append(out, snap)
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Time.After(out[j].Time) })
+	return out, nil
+}
+
+// GetSnapshot returns the snapshot with the given ID.
+func (s *YAMLRouteStore) GetSnapshot(id string) (*Snapshot, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, snap := range s.snapshots {
+		if snap.ID == id {
+			return &snap, nil
+		}
+	}
+	return nil, ErrSnapshotNotFound
 }
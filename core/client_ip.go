@@ -0,0 +1,35 @@
+package core
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net"
+	"net/http"
+)
+
+// ClientIP returns the IP address of the client connected to the gateway.
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// RequestIDHeader carries the ID that identifies a request across the
+// gateway and its upstreams.
+const RequestIDHeader = "X-Request-ID"
+
+// RequestID returns the request's ID from the X-Request-ID header. A request
+// without one is given a random ID, which is set on the request so the
+// upstream receives it too.
+func RequestID(r *http.Request) string {
+	if id := r.Header.Get(RequestIDHeader); id != "" {
+		return id
+	}
+	b := make([]byte, 16)
+	rand.Read(b)
+	id := hex.EncodeToString(b)
+	r.Header.Set(RequestIDHeader, id)
+	return id
+}
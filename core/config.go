@@ -0,0 +1,16 @@
+package core
+
+import "encoding/json"
+
+// DecodeConfig decodes a plugin's config map into out, which should be a pointer
+// to a struct with json tags. A nil config leaves out untouched.
+func DecodeConfig(config map[string]interface{}, out interface{}) error {
+	if config == nil {
+		return nil
+	}
+	data, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
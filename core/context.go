@@ -1,9 +1,68 @@
 package core
 
-import "net/http"
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
 
+// RouteInfo identifies the route a request matched.
+type RouteInfo struct {
+	ID   string
+	Path string
+}
+
+// Key returns a stable identifier for the route: its ID, or its path for
+// routes that have no ID.
+func (ri RouteInfo) Key() string {
+	if ri.ID != "" {
+		return ri.ID
+	}
+	return ri.Path
+}
+
+// RequestContext carries per-request state shared by the plugins of a route.
 type RequestContext struct {
-	Writer  http.ResponseWriter
-	Request *http.Request
-	Params  map[string]string
+	Writer   http.ResponseWriter
+	Request  *http.Request
+	Response *ResponseRecorder
+	Route    RouteInfo
+	Params   map[string]string
+	Claims   map[string]interface{} // verified token claims, set by auth plugins
+	State    map[string]interface{} // per-request state plugins keep between phases, keyed by plugin name
+
+	StartTime        time.Time     // when the gateway received the request
+	UpstreamDuration time.Duration // time spent waiting on the upstream, zero if it was not called
+
+	responses []UpstreamResponsePlugin
+}
+
+type requestContextKey struct{}
+
+// WithRequestContext returns a shallow copy of r carrying rc.
+func WithRequestContext(r *http.Request, rc *RequestContext) *http.Request {
+	r = r.WithContext(context.WithValue(r.Context(), requestContextKey{}, rc))
+	rc.Request = r
+	return r
+}
+
+// GetRequestContext returns the RequestContext attached to r, or nil if there is none.
+func GetRequestContext(r *http.Request) *RequestContext {
+	rc, _ := r.Context().Value(requestContextKey{}).(*RequestContext)
+	return rc
+}
+
+// ClaimString renders a claim value as a header value: strings as-is and
+// everything else as JSON.
+func ClaimString(value interface{}) string {
+	if s, ok := value.(string); ok {
+		return s
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
 }
@@ -0,0 +1,118 @@
+package core
+
+import (
+	"net/http"
+	"time"
+)
+
+// Pipeline runs a route's plugins through the request phases around the
+// upstream handler.
+type Pipeline struct {
+	route         RouteInfo
+	plugins       []Plugin
+	rewriters     []RewritePlugin
+	responses     []UpstreamResponsePlugin
+	headerFilters []HeaderFilterPlugin
+	bodyFilters   []BodyFilterPlugin
+	loggers       []LogPlugin
+}
+
+// NewPipeline sorts the given, already initialized plugins into their phases.
+// Within a phase plugins run in the order given.
+func NewPipeline(route RouteInfo, plugins []Plugin) *Pipeline {
+	p := &Pipeline{route: route, plugins: plugins}
+	for _, plugin := range plugins {
+		if rw, ok := plugin.(RewritePlugin); ok {
+			p.rewriters = append(p.rewriters, rw)
+		}
+		if ur, ok := plugin.(UpstreamResponsePlugin); ok {
+			p.responses = append(p.responses, ur)
+		}
+		if hf, ok := plugin.(HeaderFilterPlugin); ok {
+			p.headerFilters = append(p.headerFilters, hf)
+		}
+		if bf, ok := plugin.(BodyFilterPlugin); ok {
+			p.bodyFilters = append(p.bodyFilters, bf)
+		}
+		if lp, ok := plugin.(LogPlugin); ok {
+			p.loggers = append(p.loggers, lp)
+		}
+	}
+	return p
+}
+
+// Serve handles a request: it runs the rewrite and access phases, hands the
+// request to upstream, runs the header and body filters on the way back and
+// finally the log phase.
+func (p *Pipeline) Serve(w http.ResponseWriter, r *http.Request, params map[string]string, upstream http.Handler) {
+	recorder := NewResponseRecorder(w)
+	recorder.NoBody = r.Method == http.MethodHead
+	rc := &RequestContext{
+		Writer:    recorder,
+		Response:  recorder,
+		Route:     p.route,
+		Params:    params,
+		StartTime: time.Now(),
+		responses: p.responses,
+	}
+	r = WithRequestContext(r, rc)
+
+	if len(p.headerFilters) > 0 {
+		recorder.OnHeader = func() error {
+			for _, hf := range p.headerFilters {
+				if err := hf.HeaderFilter(rc); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	}
+	if len(p.bodyFilters) > 0 {
+		recorder.BodyFilter = func(body []byte) ([]byte, error) {
+			var err error
+			for _, bf := range p.bodyFilters {
+				if body, err = bf.BodyFilter(rc, body); err != nil {
+					return nil, err
+				}
+			}
+			return body, nil
+		}
+	}
+
+	defer func() {
+		for _, lp := range p.loggers {
+			lp.Log(rc)
+		}
+	}()
+	defer recorder.Finish()
+
+	for _, rw := range p.rewriters {
+		if err := rw.Rewrite(recorder, rc.Request); err != nil {
+			return
+		}
+	}
+	for _, plugin := range p.plugins {
+		if err := plugin.Execute(recorder, rc.Request); err != nil {
+			return
+		}
+	}
+
+	start := time.Now()
+	upstream.ServeHTTP(recorder, rc.Request)
+	rc.UpstreamDuration = time.Since(start)
+}
+
+// UpstreamResponse runs the upstream response phase of the route that resp
+// answers. The proxy calls it from httputil.ReverseProxy.ModifyResponse.
+func UpstreamResponse(resp *http.Response) error {
+	rc := GetRequestContext(resp.Request)
+	if rc == nil {
+		return nil
+	}
+	for _, ur := range rc.responses {
+		if err := ur.UpstreamResponse(rc, resp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -2,8 +2,50 @@ package core
 
 import "net/http"
 
+// Plugin is implemented by every plugin. Execute runs in the access phase,
+// before the request is proxied; returning an error stops the pipeline, in
+// which case the plugin is expected to have written a response.
+//
+// A plugin can additionally implement any of the phase interfaces below to
+// take part in the other stages of a request. Phases run in this order:
+// rewrite, access, (upstream), upstream response, header filter, body filter,
+// log.
 type Plugin interface {
 	Name() string
 	Init(config map[string]interface{}) error
 	Execute(http.ResponseWriter, *http.Request) error
 }
+
+// RewritePlugin runs before the access phase and may modify the request
+// (path, headers, body) before authentication and proxying.
+type RewritePlugin interface {
+	Rewrite(http.ResponseWriter, *http.Request) error
+}
+
+// UpstreamResponsePlugin sees the response of the upstream as it arrives in
+// the proxy, before anything is written to the client. Unlike the header
+// filter it does not run for responses the gateway produces itself. An error
+// is answered with 502 Bad Gateway.
+type UpstreamResponsePlugin interface {
+	UpstreamResponse(rc *RequestContext, resp *http.Response) error
+}
+
+// HeaderFilterPlugin runs once the response status and headers are known, before
+// they are sent to the client. It may change rc.Response.StatusCode and
+// rc.Response.Header().
+type HeaderFilterPlugin interface {
+	HeaderFilter(rc *RequestContext) error
+}
+
+// BodyFilterPlugin receives the complete response body after the header filter
+// phase and returns the body to send to the client. Routes with a body filter
+// buffer the response; Content-Length is recalculated from the result. Bodies
+// above DefaultMaxBuffer are streamed to the client without the filter.
+type BodyFilterPlugin interface {
+	BodyFilter(rc *RequestContext, body []byte) ([]byte, error)
+}
+
+// LogPlugin runs after the response has been sent to the client.
+type LogPlugin interface {
+	Log(rc *RequestContext)
+}
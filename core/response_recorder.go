@@ -1,13 +1,42 @@
 package core
 
 import (
+	"bytes"
+	"log"
 	"net/http"
+	"strconv"
 )
 
+// DefaultMaxBuffer is how much of a response body is buffered for the body
+// filters when ResponseRecorder.MaxBuffer is not set.
+const DefaultMaxBuffer = 8 << 20
+
+// ResponseRecorder wraps the client ResponseWriter and is where the response
+// phases of the plugin pipeline hook in: OnHeader runs when the status and
+// headers are about to be sent, and when BodyFilter is set the body is
+// buffered and passed through it before anything reaches the client. A body
+// larger than MaxBuffer is streamed to the client unfiltered instead.
 type ResponseRecorder struct {
 	http.ResponseWriter
 	StatusCode int
 	Bytes      int
+
+	// OnHeader is called once, before the status line and headers are sent.
+	// It may change StatusCode and Header(). An error replaces the response
+	// with a 500.
+	OnHeader func() error
+	// BodyFilter, when set, receives the complete buffered body on Finish.
+	BodyFilter func([]byte) ([]byte, error)
+	// MaxBuffer bounds the body buffered for BodyFilter, DefaultMaxBuffer if
+	// zero.
+	MaxBuffer int
+	// NoBody marks responses that must not carry a body (HEAD requests).
+	NoBody bool
+
+	wroteHeader bool
+	failed      bool
+	streaming   bool // the body outgrew MaxBuffer and bypasses BodyFilter
+	buf         bytes.Buffer
 }
 
 func NewResponseRecorder(w http.ResponseWriter) *ResponseRecorder {
@@ -18,12 +47,141 @@ func NewResponseRecorder(w http.ResponseWriter) *ResponseRecorder {
 }
 
 func (rr *ResponseRecorder) WriteHeader(code int) {
+	if rr.wroteHeader {
+		return
+	}
+	// 1xx responses are informational and do not end the header phase.
+	if code >= 100 && code < 200 && code != http.StatusSwitchingProtocols {
+		rr.ResponseWriter.WriteHeader(code)
+		return
+	}
+	rr.wroteHeader = true
 	rr.StatusCode = code
-	rr.ResponseWriter.WriteHeader(code)
+
+	if rr.OnHeader != nil {
+		if err := rr.OnHeader(); err != nil {
+			log.Printf("header filter failed: %v", err)
+			rr.fail()
+			return
+		}
+	}
+	if !rr.buffering() {
+		rr.ResponseWriter.WriteHeader(rr.StatusCode)
+	}
 }
 
 func (rr *ResponseRecorder) Write(b []byte) (int, error) {
+	if !rr.wroteHeader {
+		rr.WriteHeader(http.StatusOK)
+	}
+	if rr.failed {
+		return len(b), nil
+	}
+	if rr.buffering() {
+		if rr.buf.Len()+len(b) <= rr.maxBuffer() {
+			return rr.buf.Write(b)
+		}
+		if err := rr.stream(); err != nil {
+			return 0, err
+		}
+	}
 	n, err := rr.ResponseWriter.Write(b)
 	rr.Bytes += n
 	return n, err
 }
+
+// Flush sends buffered data to the client, unless the body is being held
+// back for a body filter.
+func (rr *ResponseRecorder) Flush() {
+	if !rr.wroteHeader || rr.failed || rr.buffering() {
+		return
+	}
+	_ = http.NewResponseController(rr.ResponseWriter).Flush()
+}
+
+// Unwrap returns the underlying ResponseWriter for http.ResponseController.
+func (rr *ResponseRecorder) Unwrap() http.ResponseWriter {
+	return rr.ResponseWriter
+}
+
+// Written reports whether the response status has been committed.
+func (rr *ResponseRecorder) Written() bool {
+	return rr.wroteHeader
+}
+
+// Finish completes the response: it sends the headers if nothing was written
+// yet and runs the body filter over any buffered body.
+func (rr *ResponseRecorder) Finish() {
+	if !rr.wroteHeader {
+		rr.WriteHeader(rr.StatusCode)
+	}
+	if rr.failed || !rr.buffering() {
+		return
+	}
+
+	body, err := rr.BodyFilter(rr.buf.Bytes())
+	if err != nil {
+		log.Printf("body filter failed: %v", err)
+		rr.fail()
+		return
+	}
+	rr.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	rr.ResponseWriter.WriteHeader(rr.StatusCode)
+	n, _ := rr.ResponseWriter.Write(body)
+	rr.Bytes += n
+}
+
+// buffering reports whether the body is being held back for BodyFilter.
+func (rr *ResponseRecorder) buffering() bool {
+	return rr.BodyFilter != nil && !rr.streaming && rr.hasBody()
+}
+
+func (rr *ResponseRecorder) maxBuffer() int {
+	if rr.MaxBuffer > 0 {
+		return rr.MaxBuffer
+	}
+	return DefaultMaxBuffer
+}
+
+// stream gives up on filtering a body that outgrew MaxBuffer: the headers
+// go out as they are and the buffered part of the body is sent, so the rest
+// can follow as it arrives.
+func (rr *ResponseRecorder) stream() error {
+	log.Printf("body filter skipped: response body exceeds %d bytes", rr.maxBuffer())
+	rr.streaming = true
+	rr.ResponseWriter.WriteHeader(rr.StatusCode)
+	n, err := rr.ResponseWriter.Write(rr.buf.Bytes())
+	rr.Bytes += n
+	rr.buf.Reset()
+	return err
+}
+
+// hasBody reports whether the response is allowed to carry a body.
+func (rr *ResponseRecorder) hasBody() bool {
+	if rr.NoBody {
+		return false
+	}
+	switch {
+	case rr.StatusCode >= 100 && rr.StatusCode < 200,
+		rr.StatusCode == http.StatusNoContent,
+		rr.StatusCode == http.StatusNotModified:
+		return false
+	}
+	return true
+}
+
+// fail replaces the response with a generic 500 and drops the rest of the body.
+func (rr *ResponseRecorder) fail() {
+	rr.failed = true
+	rr.StatusCode = http.StatusInternalServerError
+	h := rr.Header()
+	for k := range h {
+		delete(h, k)
+	}
+	h.Set("Content-Type", "text/plain; charset=utf-8")
+	body := "Internal gateway error\n"
+	h.Set("Content-Length", strconv.Itoa(len(body)))
+	rr.ResponseWriter.WriteHeader(rr.StatusCode)
+	n, _ := rr.ResponseWriter.Write([]byte(body))
+	rr.Bytes = n
+}
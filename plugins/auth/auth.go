@@ -2,13 +2,47 @@ package auth
 
 import (
 	"errors"
+	"fmt"
+	"log"
 	"net/http"
+	"strings"
 
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/alxmorales2020/api-gateway/config"
 	"github.com/alxmorales2020/api-gateway/core"
 )
 
+// Config is the per-route configuration of the jwt-auth plugin.
+type Config struct {
+	Header        string            `json:"header"`         // default: Authorization
+	Algorithms    []string          `json:"algorithms"`     // default: every algorithm the configured keys support
+	Secret        string            `json:"secret"`         // HMAC shared secret
+	Secrets       []string          `json:"secrets"`        // additional HMAC secrets, e.g. during rotation
+	PublicKeys    []string          `json:"public_keys"`    // PEM encoded keys or paths to PEM files
+	JWKSFile      string            `json:"jwks_file"`      // path to a JWKS document
+	JWKSURL       string            `json:"jwks_url"`       // URL of a JWKS document
+	JWKSRefresh   config.Duration   `json:"jwks_refresh"`   // default: 10m
+	Issuer        string            `json:"issuer"`         // required "iss" value
+	Audience      []string          `json:"audience"`       // accepted "aud" values, any one must match
+	ClockSkew     config.Duration   `json:"clock_skew"`     // leeway for exp/nbf/iat
+	ForwardClaims map[string]string `json:"forward_claims"` // claim name -> upstream request header
+}
+
+var supportedAlgorithms = map[string]bool{
+	"HS256": true, "HS384": true, "HS512": true,
+	"RS256": true, "RS384": true, "RS512": true,
+	"ES256": true, "ES384": true, "ES512": true,
+}
+
 // AuthPlugin is a plugin that handles authentication for incoming requests.
-type AuthPlugin struct{}
+type AuthPlugin struct {
+	header        string
+	staticKeys    []verificationKey
+	jwks          []*jwksSource
+	parser        *jwt.Parser
+	forwardClaims map[string]string
+}
 
 // Name returns the name of the plugin.
 func (plugin *AuthPlugin) Name() string {
@@ -16,32 +50,173 @@ func (plugin *AuthPlugin) Name() string {
 }
 
 // Init initializes the plugin with any necessary configuration.
-func (plugin *AuthPlugin) Init(config map[string]interface{}) error {
-	// Initialize the plugin with any necessary configuration.
-	// For this example, we don't have any specific configuration.
+func (plugin *AuthPlugin) Init(cfg map[string]interface{}) error {
+	var c Config
+	if err := core.DecodeConfig(cfg, &c); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+
+	plugin.header = c.Header
+	if plugin.header == "" {
+		plugin.header = "Authorization"
+	}
+
+	families := map[string]bool{}
+	secrets := c.Secrets
+	if c.Secret != "" {
+		secrets = append([]string{c.Secret}, secrets...)
+	}
+	for _, secret := range secrets {
+		plugin.staticKeys = append(plugin.staticKeys, verificationKey{Key: []byte(secret)})
+		families["HS"] = true
+	}
+	for i, value := range c.PublicKeys {
+		key, err := parsePublicKey(value)
+		if err != nil {
+			return fmt.Errorf("public_keys[%d]: %w", i, err)
+		}
+		vk := verificationKey{Key: key}
+		plugin.staticKeys = append(plugin.staticKeys, vk)
+		families[vk.family()] = true
+	}
+	for _, location := range []string{c.JWKSFile, c.JWKSURL} {
+		if location == "" {
+			continue
+		}
+		plugin.jwks = append(plugin.jwks, sharedJWKSSource(location, c.JWKSRefresh.Std()))
+		families["RS"], families["ES"] = true, true
+	}
+	if len(plugin.staticKeys) == 0 && len(plugin.jwks) == 0 {
+		return errors.New("no verification keys configured: set secret, public_keys, jwks_file or jwks_url")
+	}
+
+	algorithms := c.Algorithms
+	if len(algorithms) == 0 {
+		for alg := range supportedAlgorithms {
+			if families[alg[:2]] {
+				algorithms = append(algorithms, alg)
+			}
+		}
+	}
+	for _, alg := range algorithms {
+		if !supportedAlgorithms[alg] {
+			return fmt.Errorf("unsupported algorithm %q", alg)
+		}
+	}
+
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods(algorithms),
+		jwt.WithLeeway(c.ClockSkew.Std()),
+		jwt.WithIssuedAt(),
+	}
+	if c.Issuer != "" {
+		options = append(options, jwt.WithIssuer(c.Issuer))
+	}
+	if len(c.Audience) > 0 {
+		options = append(options, jwt.WithAudience(c.Audience...))
+	}
+	plugin.parser = jwt.NewParser(options...)
+	plugin.forwardClaims = c.ForwardClaims
 	return nil
 }
 
 // Execute checks the JWT token in the request header and validates it.
+// Verified claims are stored on the request's core.RequestContext and,
+// if configured, forwarded to the upstream as request headers.
 func (plugin *AuthPlugin) Execute(writer http.ResponseWriter, request *http.Request) error {
-	// Extract the JWT token from the Authorization header
-	token := request.Header.Get("Authorization")
+	token := plugin.extractToken(request)
 	if token == "" {
-		http.Error(writer, "Unauthorized: No token provided", http.StatusUnauthorized)
+		unauthorized(writer, "Unauthorized: No token provided", "")
 		return errors.New("no token provided")
 	}
 
-	// Here you would implement the logic to validate the JWT token.
-	// For this example, we will just check if the token equals "valid-token".
-	if token != "valid-token" {
-		http.Error(writer, "Unauthorized: Invalid token", http.StatusUnauthorized)
-		return errors.New("invalid token")
+	claims := jwt.MapClaims{}
+	if _, err := plugin.parser.ParseWithClaims(token, claims, plugin.keyFunc); err != nil {
+		log.Printf("jwt-auth: rejected token for %s %s: %v", request.Method, request.URL.Path, err)
+		unauthorized(writer, "Unauthorized: Invalid token", "invalid_token")
+		return fmt.Errorf("invalid token: %w", err)
+	}
+
+	if rc := core.GetRequestContext(request); rc != nil {
+		rc.Claims = claims
+	}
+
+	// Always clear the forwarded headers so clients cannot spoof them.
+	for claim, header := range plugin.forwardClaims {
+		request.Header.Del(header)
+		if value, ok := claims[claim]; ok {
+			request.Header.Set(header, core.ClaimString(value))
+		}
 	}
 
 	// If the token is valid, allow the request to proceed
 	return nil
 }
 
+func (plugin *AuthPlugin) extractToken(request *http.Request) string {
+	value := strings.TrimSpace(request.Header.Get(plugin.header))
+	if !strings.EqualFold(plugin.header, "Authorization") {
+		return value
+	}
+	scheme, token, ok := strings.Cut(value, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// keyFunc returns every configured key that can verify the token's algorithm,
+// narrowed to the token's "kid" when a JWKS publishes a matching key.
+func (plugin *AuthPlugin) keyFunc(token *jwt.Token) (interface{}, error) {
+	alg, _ := token.Header["alg"].(string)
+	kid, _ := token.Header["kid"].(string)
+	if len(alg) < 2 {
+		return nil, errors.New("missing alg header")
+	}
+	family := alg[:2]
+
+	var byID, all []jwt.VerificationKey
+	add := func(k verificationKey) {
+		if k.family() != family {
+			return
+		}
+		all = append(all, k.Key)
+		if kid != "" && k.ID == kid {
+			byID = append(byID, k.Key)
+		}
+	}
+	for _, k := range plugin.staticKeys {
+		add(k)
+	}
+	for _, src := range plugin.jwks {
+		keys, err := src.Keys(kid)
+		if err != nil {
+			log.Printf("jwt-auth: loading JWKS from %s: %v", src.location, err)
+			continue
+		}
+		for _, k := range keys {
+			add(k)
+		}
+	}
+
+	if len(byID) > 0 {
+		return jwt.VerificationKeySet{Keys: byID}, nil
+	}
+	if len(all) == 0 {
+		return nil, fmt.Errorf("no key available for %s", alg)
+	}
+	return jwt.VerificationKeySet{Keys: all}, nil
+}
+
+func unauthorized(writer http.ResponseWriter, message, errorCode string) {
+	challenge := "Bearer"
+	if errorCode != "" {
+		challenge += fmt.Sprintf(` error=%q`, errorCode)
+	}
+	writer.Header().Set("WWW-Authenticate", challenge)
+	http.Error(writer, message, http.StatusUnauthorized)
+}
+
 // New creates a new instance of the AuthPlugin.
 func New() core.Plugin {
 	return &AuthPlugin{}
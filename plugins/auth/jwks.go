@@ -0,0 +1,142 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultJWKSRefresh = 10 * time.Minute
+	// minJWKSRefresh bounds how often an unknown "kid" may force a refetch,
+	// so a flood of forged tokens cannot hammer the identity provider.
+	minJWKSRefresh = 30 * time.Second
+)
+
+// jwksSource loads a JSON Web Key Set from a file or URL and caches it.
+// The set is refreshed when the cache expires, or early when a token
+// references a key id that is not in the cached set (key rotation).
+type jwksSource struct {
+	location string
+	ttl      time.Duration
+	client   *http.Client
+
+	mu          sync.Mutex
+	keys        []verificationKey
+	fetchedAt   time.Time
+	lastAttempt time.Time
+}
+
+var (
+	jwksMu      sync.Mutex
+	jwksSources = map[string]*jwksSource{}
+)
+
+// sharedJWKSSource returns the cached source for location, so the key cache
+// survives router reloads and is shared by every route using the same set.
+func sharedJWKSSource(location string, ttl time.Duration) *jwksSource {
+	if ttl <= 0 {
+		ttl = defaultJWKSRefresh
+	}
+
+	jwksMu.Lock()
+	defer jwksMu.Unlock()
+
+	key := fmt.Sprintf("%s|%s", location, ttl)
+	if src, ok := jwksSources[key]; ok {
+		return src
+	}
+	src := &jwksSource{
+		location: location,
+		ttl:      ttl,
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}
+	jwksSources[key] = src
+	return src
+}
+
+// Keys returns the cached keys, refreshing them first if they are stale or if
+// kid is set and not present in the cache.
+func (s *jwksSource) Keys(kid string) ([]verificationKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	stale := len(s.keys) == 0 || now.Sub(s.fetchedAt) > s.ttl
+	missing := kid != "" && !hasKeyID(s.keys, kid)
+	if (stale || missing) && now.Sub(s.lastAttempt) >= minJWKSRefresh {
+		s.lastAttempt = now
+		keys, err := s.fetch()
+		if err != nil {
+			if len(s.keys) == 0 {
+				return nil, err
+			}
+			log.Printf("jwt-auth: refreshing JWKS from %s failed, using cached keys: %v", s.location, err)
+		} else {
+			s.keys = keys
+			s.fetchedAt = now
+		}
+	}
+	return s.keys, nil
+}
+
+func (s *jwksSource) fetch() ([]verificationKey, error) {
+	var data []byte
+	if strings.HasPrefix(s.location, "http://") || strings.HasPrefix(s.location, "https://") {
+		resp, err := s.client.Get(s.location)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("unexpected status %s", resp.Status)
+		}
+		data, err = io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		fileData, err := os.ReadFile(s.location)
+		if err != nil {
+			return nil, err
+		}
+		data = fileData
+	}
+
+	var set jwkSet
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("decode JWKS: %w", err)
+	}
+
+	keys := make([]verificationKey, 0, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.key()
+		if err != nil {
+			log.Printf("jwt-auth: skipping JWKS entry from %s: %v", s.location, err)
+			continue
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("JWKS at %s contains no usable signing keys", s.location)
+	}
+	return keys, nil
+}
+
+func hasKeyID(keys []verificationKey, kid string) bool {
+	for _, k := range keys {
+		if k.ID == kid {
+			return true
+		}
+	}
+	return false
+}
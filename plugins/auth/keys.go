@@ -0,0 +1,149 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+)
+
+// verificationKey is a key usable for signature checks, tagged with the key id
+// it was published under (if any).
+type verificationKey struct {
+	ID  string
+	Key interface{} // []byte, *rsa.PublicKey or *ecdsa.PublicKey
+}
+
+// family reports the algorithm prefix ("HS", "RS" or "ES") the key can verify.
+func (k verificationKey) family() string {
+	switch k.Key.(type) {
+	case []byte:
+		return "HS"
+	case *rsa.PublicKey:
+		return "RS"
+	case *ecdsa.PublicKey:
+		return "ES"
+	}
+	return ""
+}
+
+// parsePublicKey accepts either inline PEM or a path to a PEM file.
+func parsePublicKey(value string) (interface{}, error) {
+	data := []byte(value)
+	if !strings.Contains(value, "-----BEGIN") {
+		fileData, err := os.ReadFile(value)
+		if err != nil {
+			return nil, err
+		}
+		data = fileData
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	switch block.Type {
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return checkPublicKey(cert.PublicKey)
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return checkPublicKey(key)
+	}
+}
+
+func checkPublicKey(key interface{}) (interface{}, error) {
+	switch key.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey:
+		return key, nil
+	}
+	return nil, fmt.Errorf("unsupported public key type %T", key)
+}
+
+// jwk is a single entry of a JSON Web Key Set (RFC 7517).
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	// RSA
+	N string `json:"n"`
+	E string `json:"e"`
+	// EC
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type jwkSet struct {
+	Keys []jwk `json:"keys"`
+}
+
+// key converts the JWK into a verification key.
+func (k jwk) key() (verificationKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return verificationKey{}, fmt.Errorf("key %q: modulus: %w", k.Kid, err)
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return verificationKey{}, fmt.Errorf("key %q: exponent: %w", k.Kid, err)
+		}
+		return verificationKey{ID: k.Kid, Key: &rsa.PublicKey{N: n, E: int(e.Int64())}}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return verificationKey{}, fmt.Errorf("key %q: unsupported curve %q", k.Kid, k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return verificationKey{}, fmt.Errorf("key %q: x: %w", k.Kid, err)
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return verificationKey{}, fmt.Errorf("key %q: y: %w", k.Kid, err)
+		}
+		return verificationKey{ID: k.Kid, Key: &ecdsa.PublicKey{Curve: curve, X: x, Y: y}}, nil
+	case "oct":
+		// A JWKS is published for anyone to read, so it must not carry
+		// shared secrets; only the RS and ES families are enabled for it.
+		return verificationKey{}, fmt.Errorf("key %q: symmetric (oct) keys are not accepted from a JWKS, configure them as secret or secrets", k.Kid)
+	}
+	return verificationKey{}, fmt.Errorf("key %q: unsupported key type %q", k.Kid, k.Kty)
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, errors.New("empty value")
+	}
+	return new(big.Int).SetBytes(data), nil
+}
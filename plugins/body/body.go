@@ -0,0 +1,271 @@
+package body
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/alxmorales2020/api-gateway/core"
+)
+
+const defaultMaxBodyBytes = 1 << 20
+
+// Config is the per-route configuration of the body-transform plugin.
+type Config struct {
+	Request      []Op  `json:"request"`        // applied to JSON request bodies before proxying
+	Response     []Op  `json:"response"`       // applied to JSON upstream response bodies
+	MaxBodyBytes int64 `json:"max_body_bytes"` // default: 1MiB
+}
+
+// Op is one transformation of a JSON document.
+type Op struct {
+	Op    string      `json:"op"`    // add, remove, rename, extract, wrap or unwrap
+	Path  string      `json:"path"`  // JSONPath, e.g. $.data.items[*].id
+	To    string      `json:"to"`    // rename: new field name
+	Field string      `json:"field"` // wrap and unwrap: envelope field
+	Value interface{} `json:"value"` // add
+}
+
+// transform is a compiled Op.
+type transform struct {
+	op    string
+	path  path
+	to    string
+	field string
+	value interface{}
+}
+
+// BodyTransformPlugin rewrites JSON request bodies in the access phase and
+// JSON upstream response bodies in the upstream response phase. Bodies that
+// are not JSON pass through untouched.
+type BodyTransformPlugin struct {
+	request      []transform
+	response     []transform
+	maxBodyBytes int64
+}
+
+// Name returns the name of the plugin.
+func (plugin *BodyTransformPlugin) Name() string {
+	return "body-transform"
+}
+
+// Init compiles the transformations.
+func (plugin *BodyTransformPlugin) Init(cfg map[string]interface{}) error {
+	var c Config
+	if err := core.DecodeConfig(cfg, &c); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+	if len(c.Request)+len(c.Response) == 0 {
+		return errors.New("no transformations configured: set request or response")
+	}
+	var err error
+	if plugin.request, err = compile("request", c.Request); err != nil {
+		return err
+	}
+	if plugin.response, err = compile("response", c.Response); err != nil {
+		return err
+	}
+	plugin.maxBodyBytes = c.MaxBodyBytes
+	if plugin.maxBodyBytes <= 0 {
+		plugin.maxBodyBytes = defaultMaxBodyBytes
+	}
+	return nil
+}
+
+func compile(side string, ops []Op) ([]transform, error) {
+	out := make([]transform, 0, len(ops))
+	for i, op := range ops {
+		t, err := compileOp(op)
+		if err != nil {
+			return nil, fmt.Errorf("%s[%d]: %w", side, i, err)
+		}
+		out = append(out, t)
+	}
+	return out, nil
+}
+
+func compileOp(op Op) (transform, error) {
+	t := transform{op: op.Op, to: op.To, field: op.Field, value: op.Value}
+	switch op.Op {
+	case "add", "remove", "rename", "extract":
+		p, err := parsePath(op.Path)
+		if err != nil {
+			return t, err
+		}
+		if op.Op != "extract" && !p.endsInField() {
+			return t, fmt.Errorf("%s: path must end in a field name", op.Op)
+		}
+		if op.Op == "rename" && op.To == "" {
+			return t, errors.New("rename requires to")
+		}
+		t.path = p
+	case "wrap", "unwrap":
+		if op.Field == "" {
+			return t, fmt.Errorf("%s requires field", op.Op)
+		}
+	default:
+		return t, fmt.Errorf("unknown op %q (use add, remove, rename, extract, wrap or unwrap)", op.Op)
+	}
+	return t, nil
+}
+
+// apply runs the transformations over a decoded document.
+func apply(transforms []transform, doc interface{}) interface{} {
+	for _, t := range transforms {
+		switch t.op {
+		case "add":
+			field := t.path[len(t.path)-1].field
+			for _, parent := range t.path.parents(doc, true) {
+				parent[field] = t.value
+			}
+		case "remove":
+			field := t.path[len(t.path)-1].field
+			for _, parent := range t.path.parents(doc, false) {
+				delete(parent, field)
+			}
+		case "rename":
+			field := t.path[len(t.path)-1].field
+			for _, parent := range t.path.parents(doc, false) {
+				if value, ok := parent[field]; ok {
+					delete(parent, field)
+					parent[t.to] = value
+				}
+			}
+		case "extract":
+			values := t.path.selectValues(doc, false)
+			switch {
+			case !t.path.definite():
+				if values == nil {
+					values = []interface{}{}
+				}
+				doc = values
+			case len(values) == 1:
+				doc = values[0]
+			default:
+				doc = nil
+			}
+		case "wrap":
+			doc = map[string]interface{}{t.field: doc}
+		case "unwrap":
+			if m, ok := doc.(map[string]interface{}); ok {
+				if inner, ok := m[t.field]; ok {
+					doc = inner
+				}
+			}
+		}
+	}
+	return doc
+}
+
+// transformBody decodes body, applies transforms and encodes the result. ok
+// is false if the body is not valid JSON.
+func transformBody(transforms []transform, body []byte) (out []byte, ok bool) {
+	var doc interface{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&doc); err != nil || decoder.More() {
+		return nil, false
+	}
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(apply(transforms, doc)); err != nil {
+		return nil, false
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), true
+}
+
+// isJSON reports whether a Content-Type names JSON: application/json or
+// any type with a +json suffix.
+func isJSON(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+// encoded reports whether a body carries a Content-Encoding such as gzip,
+// which the plugin does not decode.
+func encoded(header http.Header) bool {
+	encoding := header.Get("Content-Encoding")
+	return encoding != "" && !strings.EqualFold(encoding, "identity")
+}
+
+// Execute transforms a JSON request body. Bodies above max_body_bytes are
+// refused with 413 Payload Too Large; invalid JSON is passed on untouched.
+func (plugin *BodyTransformPlugin) Execute(writer http.ResponseWriter, request *http.Request) error {
+	if len(plugin.request) == 0 || request.Body == nil || request.Body == http.NoBody ||
+		!isJSON(request.Header.Get("Content-Type")) || encoded(request.Header) {
+		return nil
+	}
+	if request.ContentLength > plugin.maxBodyBytes {
+		http.Error(writer, "Request body too large", http.StatusRequestEntityTooLarge)
+		return errors.New("request body too large")
+	}
+	body, err := io.ReadAll(io.LimitReader(request.Body, plugin.maxBodyBytes+1))
+	request.Body.Close()
+	if err != nil {
+		http.Error(writer, "Failed to read request body", http.StatusBadRequest)
+		return err
+	}
+	if int64(len(body)) > plugin.maxBodyBytes {
+		http.Error(writer, "Request body too large", http.StatusRequestEntityTooLarge)
+		return errors.New("request body too large")
+	}
+
+	if out, ok := transformBody(plugin.request, body); ok {
+		body = out
+	}
+	request.Body = io.NopCloser(bytes.NewReader(body))
+	request.ContentLength = int64(len(body))
+	request.TransferEncoding = nil
+	request.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	return nil
+}
+
+// UpstreamResponse transforms a JSON response body. Bodies above
+// max_body_bytes and invalid JSON are passed on untouched.
+func (plugin *BodyTransformPlugin) UpstreamResponse(rc *core.RequestContext, resp *http.Response) error {
+	if len(plugin.response) == 0 || resp.Body == nil || resp.Body == http.NoBody ||
+		resp.Request.Method == http.MethodHead || resp.StatusCode == http.StatusNoContent || resp.StatusCode == http.StatusNotModified ||
+		!isJSON(resp.Header.Get("Content-Type")) || encoded(resp.Header) || resp.ContentLength > plugin.maxBodyBytes {
+		return nil
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, plugin.maxBodyBytes+1))
+	if err != nil {
+		return err
+	}
+	if int64(len(body)) > plugin.maxBodyBytes {
+		log.Printf("body-transform: response of %s above %d bytes, not transformed", rc.Route.Key(), plugin.maxBodyBytes)
+		resp.Body = readCloser{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+		return nil
+	}
+	resp.Body.Close()
+
+	if out, ok := transformBody(plugin.response, body); ok {
+		body = out
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.TransferEncoding = nil
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	return nil
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// New creates a new instance of the BodyTransformPlugin.
+func New() core.Plugin {
+	return &BodyTransformPlugin{}
+}
@@ -0,0 +1,154 @@
+package body
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A path is a parsed JSONPath expression. The supported subset is the root
+// $, fields as .name or ['name'], array indexes as [n] (negative counts from
+// the end) and the wildcard .* or [*] for every member of an object or array.
+type path []segment
+
+type segment struct {
+	field    string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+func parsePath(expr string) (path, error) {
+	if !strings.HasPrefix(expr, "$") {
+		return nil, fmt.Errorf("path %q must start with $", expr)
+	}
+	var p path
+	rest := expr[1:]
+	for rest != "" {
+		switch {
+		case strings.HasPrefix(rest, ".*"):
+			p = append(p, segment{wildcard: true})
+			rest = rest[2:]
+		case rest[0] == '.':
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("path %q: empty field name", expr)
+			}
+			p = append(p, segment{field: rest[:end]})
+			rest = rest[end:]
+		case rest[0] == '[':
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("path %q: [ without matching ]", expr)
+			}
+			inner := rest[1:end]
+			rest = rest[end+1:]
+			switch {
+			case inner == "*":
+				p = append(p, segment{wildcard: true})
+			case len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0]:
+				p = append(p, segment{field: inner[1 : len(inner)-1]})
+			default:
+				n, err := strconv.Atoi(inner)
+				if err != nil {
+					return nil, fmt.Errorf("path %q: invalid index %q", expr, inner)
+				}
+				p = append(p, segment{index: n, isIndex: true})
+			}
+		default:
+			return nil, fmt.Errorf("path %q: unexpected %q", expr, rest[:1])
+		}
+	}
+	return p, nil
+}
+
+// definite reports whether the path selects at most one value.
+func (p path) definite() bool {
+	for _, seg := range p {
+		if seg.wildcard {
+			return false
+		}
+	}
+	return true
+}
+
+// endsInField reports whether the last segment names an object field, as
+// add, remove and rename require.
+func (p path) endsInField() bool {
+	return len(p) > 0 && !p[len(p)-1].wildcard && !p[len(p)-1].isIndex
+}
+
+// selectValues returns every value the path selects in doc. With create,
+// missing objects along field segments are created, so the values returned
+// for a path ending in a field are its parents' objects ready to be set.
+func (p path) selectValues(doc interface{}, create bool) []interface{} {
+	values := []interface{}{doc}
+	for _, seg := range p {
+		var next []interface{}
+		for _, v := range values {
+			next = append(next, seg.children(v, create)...)
+		}
+		values = next
+	}
+	return values
+}
+
+func (seg segment) children(v interface{}, create bool) []interface{} {
+	switch node := v.(type) {
+	case map[string]interface{}:
+		switch {
+		case seg.wildcard:
+			keys := make([]string, 0, len(node))
+			for key := range node {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			out := make([]interface{}, 0, len(keys))
+			for _, key := range keys {
+				out = append(out, node[key])
+			}
+			return out
+		case seg.isIndex:
+			return nil
+		}
+		child, ok := node[seg.field]
+		if !ok && create {
+			child = map[string]interface{}{}
+			node[seg.field] = child
+			ok = true
+		}
+		if ok {
+			return []interface{}{child}
+		}
+	case []interface{}:
+		switch {
+		case seg.wildcard:
+			return node
+		case seg.isIndex:
+			i := seg.index
+			if i < 0 {
+				i += len(node)
+			}
+			if i >= 0 && i < len(node) {
+				return []interface{}{node[i]}
+			}
+		}
+	}
+	return nil
+}
+
+// parents returns the objects holding the field the path ends in.
+func (p path) parents(doc interface{}, create bool) []map[string]interface{} {
+	var out []map[string]interface{}
+	for _, v := range p[:len(p)-1].selectValues(doc, create) {
+		if m, ok := v.(map[string]interface{}); ok {
+			out = append(out, m)
+		}
+	}
+	return out
+}
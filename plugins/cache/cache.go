@@ -0,0 +1,291 @@
+package cache
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alxmorales2020/api-gateway/config"
+	"github.com/alxmorales2020/api-gateway/core"
+)
+
+const (
+	defaultMaxBytes      = 64 << 20
+	defaultMaxEntryBytes = 1 << 20
+	defaultDir           = "cache"
+)
+
+// Config is the per-route configuration of the cache plugin.
+type Config struct {
+	Storage       string          `json:"storage"`         // memory (default), disk or a name passed to RegisterStorage
+	MaxBytes      int64           `json:"max_bytes"`       // size bound of the memory and disk storages, default: 64MiB
+	Dir           string          `json:"dir"`             // disk storage directory, default: cache
+	MaxEntryBytes int64           `json:"max_entry_bytes"` // larger responses are not cached, default: 1MiB
+	DefaultTTL    config.Duration `json:"default_ttl"`     // freshness of responses without Cache-Control or Expires, default: 0
+	QueryParams   []string        `json:"query_params"`    // query parameters in the key, default: all
+}
+
+// errCacheHit stops the pipeline once a response was served from the cache.
+var errCacheHit = errors.New("served from cache")
+
+// CachePlugin serves GET and HEAD requests from stored upstream responses.
+// Lookups happen in the access phase; responses are stored, and stale
+// entries revalidated, in the upstream response phase.
+type CachePlugin struct {
+	cfg     Config
+	storage func() (Storage, error)
+}
+
+// state is what the access phase leaves for the upstream response phase.
+type state struct {
+	storage Storage
+	base    string // key of the request, without Vary
+	key     string // key of the entry, with Vary
+	stale   *Entry // being revalidated
+}
+
+// Name returns the name of the plugin.
+func (plugin *CachePlugin) Name() string {
+	return "cache"
+}
+
+// Init checks the configuration. A disk storage is opened, and its index
+// rebuilt from the files, right away so Purge reaches entries left from
+// before a restart; a memory storage is created on first use.
+func (plugin *CachePlugin) Init(cfg map[string]interface{}) error {
+	var c Config
+	if err := core.DecodeConfig(cfg, &c); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+	if c.MaxBytes <= 0 {
+		c.MaxBytes = defaultMaxBytes
+	}
+	if c.MaxEntryBytes <= 0 {
+		c.MaxEntryBytes = defaultMaxEntryBytes
+	}
+	if c.DefaultTTL < 0 {
+		return errors.New("default_ttl must not be negative")
+	}
+
+	switch c.Storage {
+	case "", "memory":
+		c.Storage = "memory"
+		name := fmt.Sprintf("memory:%d", c.MaxBytes)
+		plugin.storage = func() (Storage, error) {
+			return sharedStorage(name, func() (Storage, error) { return newMemoryStorage(c.MaxBytes), nil })
+		}
+	case "disk":
+		if c.Dir == "" {
+			c.Dir = defaultDir
+		}
+		s, err := sharedStorage("disk:"+c.Dir, func() (Storage, error) { return newDiskStorage(c.Dir, c.MaxBytes) })
+		if err != nil {
+			return fmt.Errorf("disk storage: %w", err)
+		}
+		plugin.storage = func() (Storage, error) { return s, nil }
+	default:
+		s, ok := registeredStorage(c.Storage)
+		if !ok {
+			return fmt.Errorf("storage %q is not registered", c.Storage)
+		}
+		plugin.storage = func() (Storage, error) { return s, nil }
+	}
+	plugin.cfg = c
+	return nil
+}
+
+// key builds the cache key of a request: the route, method, path and the
+// configured query parameters in a fixed order.
+func (plugin *CachePlugin) key(rc *core.RequestContext, r *http.Request) string {
+	query := r.URL.Query()
+	if plugin.cfg.QueryParams != nil {
+		kept := url.Values{}
+		for _, name := range plugin.cfg.QueryParams {
+			if values, ok := query[name]; ok {
+				kept[name] = values
+			}
+		}
+		query = kept
+	}
+	key := rc.Route.Key() + " " + r.Method + " " + r.URL.EscapedPath()
+	if len(query) > 0 {
+		key += "?" + query.Encode() // Encode sorts by name
+	}
+	return key
+}
+
+// variant extends a key with the request's values of the Vary headers.
+func variant(base string, names []string, header http.Header) string {
+	sorted := append([]string(nil), names...)
+	sort.Strings(sorted)
+	var b strings.Builder
+	b.WriteString(base)
+	for _, name := range sorted {
+		fmt.Fprintf(&b, " %s=%q", name, strings.Join(header.Values(name), ","))
+	}
+	return b.String()
+}
+
+// Execute answers from the cache when a fresh entry exists. A stale entry
+// with a validator is revalidated: the request to the upstream is made
+// conditional, unless the client already made it so.
+func (plugin *CachePlugin) Execute(writer http.ResponseWriter, request *http.Request) error {
+	rc := core.GetRequestContext(request)
+	if rc == nil || (request.Method != http.MethodGet && request.Method != http.MethodHead) {
+		return nil
+	}
+	requestCC := parseCacheControl(request.Header)
+	if requestCC.has("no-store") {
+		return nil
+	}
+	storage, err := plugin.storage()
+	if err != nil {
+		return nil
+	}
+
+	st := &state{storage: storage, base: plugin.key(rc, request)}
+	st.key = st.base
+	if rc.State == nil {
+		rc.State = map[string]interface{}{}
+	}
+	rc.State["cache"] = st
+
+	entry, ok := storage.Get(st.base)
+	if ok && entry.Vary != nil {
+		st.key = variant(st.base, entry.Vary, request.Header)
+		entry, ok = storage.Get(st.key)
+	}
+	if !ok {
+		return nil
+	}
+
+	now := time.Now()
+	if now.Before(entry.Expires) && !requestCC.has("no-cache") {
+		serve(writer, request, entry, now)
+		return errCacheHit
+	}
+	if hasValidator(entry.Header) && request.Header.Get("If-None-Match") == "" && request.Header.Get("If-Modified-Since") == "" {
+		st.stale = entry
+		if etag := entry.Header.Get("ETag"); etag != "" {
+			request.Header.Set("If-None-Match", etag)
+		}
+		if modified := entry.Header.Get("Last-Modified"); modified != "" {
+			request.Header.Set("If-Modified-Since", modified)
+		}
+	}
+	return nil
+}
+
+// serve writes a cached response, or 304 if the client's conditional
+// headers match it.
+func serve(writer http.ResponseWriter, request *http.Request, entry *Entry, now time.Time) {
+	header := writer.Header()
+	for name, values := range entry.Header {
+		header[name] = append([]string(nil), values...)
+	}
+	header.Set("Age", strconv.Itoa(int(now.Sub(entry.Stored)/time.Second)))
+	header.Set("X-Cache", "HIT")
+	if notModified(request, entry) {
+		header.Del("Content-Length")
+		writer.WriteHeader(http.StatusNotModified)
+		return
+	}
+	header.Set("Content-Length", contentLength(request.Method, entry))
+	writer.WriteHeader(entry.Status)
+	writer.Write(entry.Body)
+}
+
+// contentLength returns the Content-Length to answer with an entry. A HEAD
+// entry, or any entry stored without a body, keeps the stored header: it
+// describes a body that was never sent to the gateway.
+func contentLength(method string, entry *Entry) string {
+	if stored := entry.Header.Get("Content-Length"); stored != "" && (method == http.MethodHead || len(entry.Body) == 0) {
+		return stored
+	}
+	return strconv.Itoa(len(entry.Body))
+}
+
+// UpstreamResponse stores cacheable responses and completes revalidations:
+// a 304 for a stale entry refreshes it and is answered with the entry.
+func (plugin *CachePlugin) UpstreamResponse(rc *core.RequestContext, resp *http.Response) error {
+	st, _ := rc.State["cache"].(*state)
+	if st == nil {
+		return nil
+	}
+	now := time.Now()
+
+	if resp.StatusCode == http.StatusNotModified && st.stale != nil {
+		entry := *st.stale
+		entry.Header = entry.Header.Clone()
+		for name, values := range resp.Header {
+			entry.Header[name] = values
+		}
+		cc := parseCacheControl(entry.Header)
+		entry.Stored = now
+		entry.Expires = now.Add(freshness(entry.Header, cc, now, plugin.cfg.DefaultTTL.Std()))
+		st.storage.Set(st.key, &entry)
+
+		resp.StatusCode = entry.Status
+		resp.Status = fmt.Sprintf("%d %s", entry.Status, http.StatusText(entry.Status))
+		resp.Header = entry.Header.Clone()
+		resp.Header.Set("X-Cache", "HIT")
+		resp.Header.Set("Content-Length", contentLength(rc.Request.Method, &entry))
+		resp.ContentLength = int64(len(entry.Body))
+		resp.Body.Close()
+		resp.Body = io.NopCloser(bytes.NewReader(entry.Body))
+		return nil
+	}
+
+	resp.Header.Set("X-Cache", "MISS")
+	cc := parseCacheControl(resp.Header)
+	ttl := freshness(resp.Header, cc, now, plugin.cfg.DefaultTTL.Std())
+	if !storable(rc.Request, resp, cc) || (ttl <= 0 && !hasValidator(resp.Header)) ||
+		resp.ContentLength > plugin.cfg.MaxEntryBytes {
+		return nil
+	}
+
+	var body []byte
+	if resp.Body != nil && resp.Body != http.NoBody {
+		var err error
+		body, err = io.ReadAll(io.LimitReader(resp.Body, plugin.cfg.MaxEntryBytes+1))
+		if err != nil {
+			return err
+		}
+		if int64(len(body)) > plugin.cfg.MaxEntryBytes {
+			resp.Body = readCloser{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+			return nil
+		}
+		resp.Body.Close()
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	header := resp.Header.Clone()
+	for _, name := range []string{"X-Cache", "Set-Cookie", "Connection", "Keep-Alive", "Transfer-Encoding"} {
+		header.Del(name)
+	}
+	entry := &Entry{Status: resp.StatusCode, Header: header, Body: body, Stored: now, Expires: now.Add(ttl)}
+	key := st.base
+	if names := varyNames(resp.Header); len(names) > 0 {
+		st.storage.Set(st.base, &Entry{Vary: names, Stored: now, Expires: entry.Expires})
+		key = variant(st.base, names, rc.Request.Header)
+	}
+	st.storage.Set(key, entry)
+	return nil
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// New creates a new instance of the CachePlugin.
+func New() core.Plugin {
+	return &CachePlugin{}
+}
@@ -0,0 +1,140 @@
+package cache
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cacheControl holds the directives of a Cache-Control header, lower case,
+// with their arguments.
+type cacheControl map[string]string
+
+func parseCacheControl(header http.Header) cacheControl {
+	cc := cacheControl{}
+	for _, value := range header.Values("Cache-Control") {
+		for _, directive := range strings.Split(value, ",") {
+			name, arg, _ := strings.Cut(strings.TrimSpace(directive), "=")
+			if name != "" {
+				cc[strings.ToLower(name)] = strings.Trim(arg, `"`)
+			}
+		}
+	}
+	return cc
+}
+
+func (cc cacheControl) has(directive string) bool {
+	_, ok := cc[directive]
+	return ok
+}
+
+// seconds returns a directive's delta-seconds argument.
+func (cc cacheControl) seconds(directive string) (time.Duration, bool) {
+	arg, ok := cc[directive]
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.Atoi(arg)
+	if err != nil || n < 0 {
+		return 0, true
+	}
+	return time.Duration(n) * time.Second, true
+}
+
+// cacheableStatus lists the statuses whose responses are stored.
+var cacheableStatus = map[int]bool{
+	http.StatusOK:                   true,
+	http.StatusNonAuthoritativeInfo: true,
+	http.StatusMultipleChoices:      true,
+	http.StatusMovedPermanently:     true,
+	http.StatusNotFound:             true,
+	http.StatusGone:                 true,
+}
+
+// freshness returns how long a response may be served without revalidation:
+// s-maxage, then max-age, then Expires relative to Date, then defaultTTL.
+// no-cache responses are stored but always revalidated.
+func freshness(header http.Header, cc cacheControl, now time.Time, defaultTTL time.Duration) time.Duration {
+	if cc.has("no-cache") {
+		return 0
+	}
+	if ttl, ok := cc.seconds("s-maxage"); ok {
+		return ttl
+	}
+	if ttl, ok := cc.seconds("max-age"); ok {
+		return ttl
+	}
+	if expires := header.Get("Expires"); expires != "" {
+		at, err := http.ParseTime(expires)
+		if err != nil {
+			return 0 // invalid dates mean already expired
+		}
+		date, err := http.ParseTime(header.Get("Date"))
+		if err != nil {
+			date = now
+		}
+		return at.Sub(date)
+	}
+	return defaultTTL
+}
+
+// storable reports whether a shared cache may keep the response to r.
+func storable(r *http.Request, resp *http.Response, cc cacheControl) bool {
+	if !cacheableStatus[resp.StatusCode] || cc.has("no-store") || cc.has("private") {
+		return false
+	}
+	for _, name := range varyNames(resp.Header) {
+		if name == "*" {
+			return false
+		}
+	}
+	// Responses to authorized requests are only shared when the upstream
+	// says so.
+	if r.Header.Get("Authorization") != "" && !cc.has("public") && !cc.has("s-maxage") && !cc.has("must-revalidate") {
+		return false
+	}
+	return true
+}
+
+// hasValidator reports whether a response can be revalidated.
+func hasValidator(header http.Header) bool {
+	return header.Get("ETag") != "" || header.Get("Last-Modified") != ""
+}
+
+// notModified reports whether the conditional headers of r match entry, so
+// 304 Not Modified is the answer.
+func notModified(r *http.Request, entry *Entry) bool {
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		etag := strings.TrimPrefix(entry.Header.Get("ETag"), "W/")
+		if etag == "" {
+			return false
+		}
+		for _, candidate := range strings.Split(inm, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+				return true
+			}
+		}
+		return false
+	}
+	if ims := r.Header.Get("If-Modified-Since"); ims != "" {
+		since, err := http.ParseTime(ims)
+		modified, err2 := http.ParseTime(entry.Header.Get("Last-Modified"))
+		return err == nil && err2 == nil && !modified.After(since)
+	}
+	return false
+}
+
+// varyNames returns the header names a response varies on, canonicalized.
+func varyNames(header http.Header) []string {
+	var names []string
+	for _, value := range header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	return names
+}
@@ -0,0 +1,317 @@
+package cache
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Entry is a cached response.
+type Entry struct {
+	Status  int         `json:"status"`
+	Header  http.Header `json:"header"`
+	Body    []byte      `json:"body"`
+	Stored  time.Time   `json:"stored"`         // when the response was received or last revalidated
+	Expires time.Time   `json:"expires"`        // end of freshness
+	Vary    []string    `json:"vary,omitempty"` // set on the marker kept under a key whose responses vary
+}
+
+func (e *Entry) size(key string) int64 {
+	n := len(key) + len(e.Body)
+	for name, values := range e.Header {
+		n += len(name)
+		for _, v := range values {
+			n += len(v)
+		}
+	}
+	return int64(n)
+}
+
+// Storage keeps cached responses by key. Implementations must be safe for
+// concurrent use.
+type Storage interface {
+	Get(key string) (*Entry, bool)
+	Set(key string, entry *Entry)
+	// Purge removes every entry whose key starts with prefix and returns
+	// how many were removed.
+	Purge(prefix string) int
+}
+
+var (
+	storagesMu sync.Mutex
+	storages   = map[string]Storage{}
+)
+
+// RegisterStorage makes a storage available to routes as storage: name.
+func RegisterStorage(name string, s Storage) {
+	storagesMu.Lock()
+	defer storagesMu.Unlock()
+	storages[name] = s
+}
+
+// registeredStorage returns the storage registered under name.
+func registeredStorage(name string) (Storage, bool) {
+	storagesMu.Lock()
+	defer storagesMu.Unlock()
+	s, ok := storages[name]
+	return s, ok
+}
+
+// sharedStorage returns the storage registered under name, creating it with
+// create if needed. Storages live outside the plugin instances, so cached
+// responses survive router reloads.
+func sharedStorage(name string, create func() (Storage, error)) (Storage, error) {
+	storagesMu.Lock()
+	defer storagesMu.Unlock()
+	if s, ok := storages[name]; ok {
+		return s, nil
+	}
+	s, err := create()
+	if err != nil {
+		return nil, err
+	}
+	storages[name] = s
+	return s, nil
+}
+
+// Purge removes the entries whose key starts with prefix from every storage
+// and returns how many were removed. Keys start with the route's ID, or its
+// path for routes without one, followed by a space.
+func Purge(prefix string) int {
+	storagesMu.Lock()
+	defer storagesMu.Unlock()
+	n := 0
+	for _, s := range storages {
+		n += s.Purge(prefix)
+	}
+	return n
+}
+
+// lru tracks keys by recent use and evicts the least recently used ones
+// once their total size exceeds maxBytes.
+type lru struct {
+	maxBytes int64
+	size     int64
+	ll       *list.List
+	items    map[string]*list.Element
+	onEvict  func(key string)
+}
+
+type lruItem struct {
+	key   string
+	size  int64
+	entry *Entry // nil for the disk storage
+}
+
+func newLRU(maxBytes int64, onEvict func(string)) *lru {
+	return &lru{maxBytes: maxBytes, ll: list.New(), items: map[string]*list.Element{}, onEvict: onEvict}
+}
+
+func (c *lru) get(key string) (*lruItem, bool) {
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.ll.MoveToFront(el)
+	return el.Value.(*lruItem), true
+}
+
+func (c *lru) add(item *lruItem) {
+	if el, ok := c.items[item.key]; ok {
+		c.size -= el.Value.(*lruItem).size
+		el.Value = item
+		c.ll.MoveToFront(el)
+	} else {
+		c.items[item.key] = c.ll.PushFront(item)
+	}
+	c.size += item.size
+	for c.size > c.maxBytes && c.ll.Len() > 0 {
+		c.remove(c.ll.Back())
+	}
+}
+
+func (c *lru) remove(el *list.Element) {
+	item := el.Value.(*lruItem)
+	c.ll.Remove(el)
+	delete(c.items, item.key)
+	c.size -= item.size
+	if c.onEvict != nil {
+		c.onEvict(item.key)
+	}
+}
+
+func (c *lru) purge(prefix string) int {
+	n := 0
+	for key, el := range c.items {
+		if strings.HasPrefix(key, prefix) {
+			c.remove(el)
+			n++
+		}
+	}
+	return n
+}
+
+// memoryStorage keeps entries in memory, bounded by their total size.
+type memoryStorage struct {
+	mu  sync.Mutex
+	lru *lru
+}
+
+func newMemoryStorage(maxBytes int64) *memoryStorage {
+	return &memoryStorage{lru: newLRU(maxBytes, nil)}
+}
+
+func (s *memoryStorage) Get(key string) (*Entry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	item, ok := s.lru.get(key)
+	if !ok {
+		return nil, false
+	}
+	return item.entry, true
+}
+
+func (s *memoryStorage) Set(key string, entry *Entry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lru.add(&lruItem{key: key, size: entry.size(key), entry: entry})
+}
+
+func (s *memoryStorage) Purge(prefix string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lru.purge(prefix)
+}
+
+// diskStorage keeps one file per entry in a directory, bounded by their
+// total size. The index of keys is rebuilt from the files on start.
+type diskStorage struct {
+	dir string
+	mu  sync.Mutex
+	lru *lru
+}
+
+type diskEntry struct {
+	Key   string `json:"key"`
+	Entry *Entry `json:"entry"`
+}
+
+func newDiskStorage(dir string, maxBytes int64) (*diskStorage, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	s := &diskStorage{dir: dir}
+	s.lru = newLRU(maxBytes, func(key string) {
+		if err := os.Remove(s.file(key)); err != nil && !os.IsNotExist(err) {
+			log.Printf("cache: removing %s: %v", s.file(key), err)
+		}
+	})
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	type found struct {
+		key  string
+		size int64
+		mod  time.Time
+	}
+	var index []found
+	for _, f := range files {
+		info, err := f.Info()
+		if err != nil || !info.Mode().IsRegular() || strings.HasPrefix(f.Name(), ".") {
+			continue
+		}
+		de, err := readDiskEntry(filepath.Join(dir, f.Name()))
+		if err != nil {
+			log.Printf("cache: skipping %s: %v", f.Name(), err)
+			continue
+		}
+		index = append(index, found{key: de.Key, size: info.Size(), mod: info.ModTime()})
+	}
+	// Oldest first, so the most recently written end up most recently used.
+	sort.Slice(index, func(i, j int) bool { return index[i].mod.Before(index[j].mod) })
+	for _, f := range index {
+		s.lru.add(&lruItem{key: f.key, size: f.size})
+	}
+	return s, nil
+}
+
+func (s *diskStorage) file(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:]))
+}
+
+func readDiskEntry(path string) (*diskEntry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var de diskEntry
+	if err := json.Unmarshal(data, &de); err != nil {
+		return nil, err
+	}
+	if de.Entry == nil {
+		return nil, errors.New("no entry")
+	}
+	return &de, nil
+}
+
+func (s *diskStorage) Get(key string) (*Entry, bool) {
+	s.mu.Lock()
+	_, ok := s.lru.get(key)
+	s.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+	de, err := readDiskEntry(s.file(key))
+	if err != nil || de.Key != key {
+		return nil, false
+	}
+	return de.Entry, true
+}
+
+func (s *diskStorage) Set(key string, entry *Entry) {
+	data, err := json.Marshal(diskEntry{Key: key, Entry: entry})
+	if err != nil {
+		log.Printf("cache: encoding %s: %v", key, err)
+		return
+	}
+	tmp, err := os.CreateTemp(s.dir, ".tmp-")
+	if err != nil {
+		log.Printf("cache: writing %s: %v", key, err)
+		return
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), s.file(key))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		log.Printf("cache: writing %s: %v", key, err)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lru.add(&lruItem{key: key, size: int64(len(data))})
+}
+
+func (s *diskStorage) Purge(prefix string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lru.purge(prefix)
+}
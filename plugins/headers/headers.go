@@ -0,0 +1,185 @@
+package headers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/alxmorales2020/api-gateway/core"
+)
+
+// Config is the per-route configuration of the header-transform plugin.
+type Config struct {
+	Request  []Rule `json:"request"`  // applied to the request sent upstream
+	Response []Rule `json:"response"` // applied to the upstream's response
+}
+
+// Rule is one header operation. Value may hold ${...} variables.
+type Rule struct {
+	Op    string `json:"op"`    // add, set, remove or rename
+	Name  string `json:"name"`  // header to change
+	Value string `json:"value"` // add and set
+	To    string `json:"to"`    // rename: new header name
+}
+
+var variablePattern = regexp.MustCompile(`\$\{([^}]*)\}`)
+
+// HeaderTransformPlugin adds, sets, removes and renames headers of the
+// request to the upstream in the access phase and of the upstream's response
+// in the upstream response phase. Rules run in the order configured.
+type HeaderTransformPlugin struct {
+	request  []Rule
+	response []Rule
+}
+
+// Name returns the name of the plugin.
+func (plugin *HeaderTransformPlugin) Name() string {
+	return "header-transform"
+}
+
+// Init checks the rules and the variables their values use.
+func (plugin *HeaderTransformPlugin) Init(cfg map[string]interface{}) error {
+	var c Config
+	if err := core.DecodeConfig(cfg, &c); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+	if len(c.Request)+len(c.Response) == 0 {
+		return errors.New("no rules configured: set request or response")
+	}
+	for side, rules := range map[string][]Rule{"request": c.Request, "response": c.Response} {
+		for i, rule := range rules {
+			if err := checkRule(rule); err != nil {
+				return fmt.Errorf("%s[%d]: %w", side, i, err)
+			}
+		}
+	}
+	plugin.request, plugin.response = c.Request, c.Response
+	return nil
+}
+
+func checkRule(rule Rule) error {
+	if rule.Name == "" {
+		return errors.New("name is required")
+	}
+	switch rule.Op {
+	case "add", "set":
+		for _, m := range variablePattern.FindAllStringSubmatch(rule.Value, -1) {
+			if !knownVariable(m[1]) {
+				return fmt.Errorf("unknown variable ${%s}", m[1])
+			}
+		}
+	case "remove":
+	case "rename":
+		if rule.To == "" {
+			return errors.New("rename requires to")
+		}
+	default:
+		return fmt.Errorf("unknown op %q (use add, set, remove or rename)", rule.Op)
+	}
+	return nil
+}
+
+func knownVariable(name string) bool {
+	switch name {
+	case "client_ip", "request_id", "route_id":
+		return true
+	}
+	for _, prefix := range []string{"param.", "claim.", "header."} {
+		if strings.HasPrefix(name, prefix) && len(name) > len(prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Execute applies the request rules. Listed after jwt-auth, the rules can
+// use the verified claims.
+func (plugin *HeaderTransformPlugin) Execute(writer http.ResponseWriter, request *http.Request) error {
+	if len(plugin.request) == 0 {
+		return nil
+	}
+	rc := core.GetRequestContext(request)
+	apply(plugin.request, request.Header, func(name string) string {
+		return variable(rc, request, name)
+	})
+	return nil
+}
+
+// UpstreamResponse applies the response rules.
+func (plugin *HeaderTransformPlugin) UpstreamResponse(rc *core.RequestContext, resp *http.Response) error {
+	apply(plugin.response, resp.Header, func(name string) string {
+		return variable(rc, rc.Request, name)
+	})
+	return nil
+}
+
+// apply runs rules against header. Add and set are skipped if the value
+// comes out empty, e.g. for a claim the token does not carry.
+func apply(rules []Rule, header http.Header, lookup func(string) string) {
+	for _, rule := range rules {
+		switch rule.Op {
+		case "add", "set":
+			value := variablePattern.ReplaceAllStringFunc(rule.Value, func(v string) string {
+				return lookup(v[2 : len(v)-1])
+			})
+			if value == "" {
+				continue
+			}
+			if rule.Op == "add" {
+				header.Add(rule.Name, value)
+			} else {
+				header.Set(rule.Name, value)
+			}
+		case "remove":
+			header.Del(rule.Name)
+		case "rename":
+			values := header.Values(rule.Name)
+			if len(values) == 0 {
+				continue
+			}
+			header.Del(rule.Name)
+			header.Del(rule.To)
+			for _, value := range values {
+				header.Add(rule.To, value)
+			}
+		}
+	}
+}
+
+// variable returns the value of a ${...} variable for a request.
+func variable(rc *core.RequestContext, request *http.Request, name string) string {
+	switch name {
+	case "client_ip":
+		return core.ClientIP(request)
+	case "request_id":
+		return core.RequestID(request)
+	case "route_id":
+		if rc != nil {
+			return rc.Route.Key()
+		}
+		return ""
+	}
+	kind, key, _ := strings.Cut(name, ".")
+	switch kind {
+	case "header":
+		return request.Header.Get(key)
+	case "param":
+		if rc != nil {
+			return rc.Params[key]
+		}
+	case "claim":
+		if rc != nil {
+			if value, ok := rc.Claims[key]; ok {
+				return core.ClaimString(value)
+			}
+		}
+	}
+	return ""
+}
+
+// New creates a new instance of the HeaderTransformPlugin.
+func New() core.Plugin {
+	return &HeaderTransformPlugin{}
+}
@@ -9,6 +9,7 @@ import (
 )
 
 // LoggingPlugin is a plugin that logs request and response details.
+// It does its work in the log phase, once the response has been sent.
 type LoggingPlugin struct{}
 
 func (plugin *LoggingPlugin) Name() string {
@@ -22,28 +23,22 @@ func (plugin *LoggingPlugin) Init(config map[string]interface{}) error {
 }
 
 func (plugin *LoggingPlugin) Execute(writer http.ResponseWriter, request *http.Request) error {
-	recorder, ok := writer.(*core.ResponseRecorder)
-	if !ok {
-		fmt.Println("WARNING: ResponseWriter not wrapped")
-		return nil
-	}
-
-	startTime := time.Now()
-
-	defer func() {
-		duration := time.Since(startTime)
-		fmt.Printf("[%s] %s %d %dB %v\n",
-			request.Method,
-			request.URL.Path,
-			recorder.StatusCode,
-			recorder.Bytes,
-			duration,
-		)
-	}()
-
 	return nil
 }
 
+// Log prints the final status, response size, total duration and the part
+// of it spent waiting on the upstream.
+func (plugin *LoggingPlugin) Log(rc *core.RequestContext) {
+	fmt.Printf("[%s] %s %d %dB %v (upstream %v)\n",
+		rc.Request.Method,
+		rc.Request.URL.Path,
+		rc.Response.StatusCode,
+		rc.Response.Bytes,
+		time.Since(rc.StartTime),
+		rc.UpstreamDuration,
+	)
+}
+
 // Register the plugin with the core plugin manager
 func New() core.Plugin {
 	return &LoggingPlugin{}
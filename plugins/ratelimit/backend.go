@@ -0,0 +1,34 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Backend is a counter store shared by every gateway replica, used by routes
+// with `scope: cluster`. Implementations must be safe for concurrent use.
+type Backend interface {
+	// Increment adds n to the counter stored under key and returns the new
+	// total. The counter may be discarded after expireAt.
+	Increment(ctx context.Context, key string, n int64, expireAt time.Time) (int64, error)
+}
+
+var (
+	backendMu sync.RWMutex
+	backend   Backend
+)
+
+// SetBackend sets the shared backend for cluster-scoped limits. It must be
+// called before the routes using them are built; nil disables it.
+func SetBackend(b Backend) {
+	backendMu.Lock()
+	defer backendMu.Unlock()
+	backend = b
+}
+
+func currentBackend() Backend {
+	backendMu.RLock()
+	defer backendMu.RUnlock()
+	return backend
+}
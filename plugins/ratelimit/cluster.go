@@ -0,0 +1,190 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	defaultSyncInterval = 250 * time.Millisecond
+	backendTimeout      = time.Second
+)
+
+// clusterLimiter enforces a limit across gateway replicas with the sliding
+// window counter approximation: the count of the current fixed window plus
+// the previous window's count weighted by how much of it still overlaps the
+// sliding window.
+//
+// To keep round trips off the request path, decisions are made locally from
+// the last known cluster totals plus the requests counted since, and the
+// local counts are pushed to the backend in batches every sync interval.
+// Replicas can therefore overshoot the limit by the requests they admit
+// within one interval. While the backend is unreachable every replica limits
+// on its own counts alone.
+type clusterLimiter struct {
+	name     string // prefix of the backend keys
+	limit    int
+	window   time.Duration
+	interval time.Duration
+	backend  Backend
+
+	mu       sync.Mutex
+	counters map[string]*clusterCounter
+	lastSync time.Time
+	syncing  bool
+	degraded bool
+}
+
+// clusterCounter is the state of one key in its current window.
+type clusterCounter struct {
+	start    time.Time // start of the current fixed window
+	previous float64   // total of the previous window
+	total    int64     // cluster total of the current window as of the last sync
+	flushing int64     // local requests being pushed to the backend
+	pending  int64     // local requests not yet pushed
+}
+
+func newClusterLimiter(name string, limit int, window, interval time.Duration, b Backend) *clusterLimiter {
+	if interval <= 0 {
+		interval = defaultSyncInterval
+	}
+	return &clusterLimiter{
+		name:     name,
+		limit:    limit,
+		window:   window,
+		interval: interval,
+		backend:  b,
+		counters: map[string]*clusterCounter{},
+	}
+}
+
+func (cl *clusterLimiter) Allow(key string, now time.Time) Result {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	c, ok := cl.counters[key]
+	if !ok {
+		c = &clusterCounter{}
+		cl.counters[key] = c
+	}
+	cl.roll(c, now)
+
+	elapsed := now.Sub(c.start)
+	weight := 1 - elapsed.Seconds()/cl.window.Seconds()
+	current := float64(c.count())
+	limit := float64(cl.limit)
+
+	res := Result{Limit: cl.limit, Reset: cl.window - elapsed}
+	if c.previous*weight+current < limit {
+		c.pending++
+		current++
+		res.Allowed = true
+	} else if current >= limit || c.previous == 0 {
+		res.RetryAfter = cl.window - elapsed
+	} else {
+		// The previous window's share drops below the remaining quota once
+		// previous * (1 - t/window) + current < limit.
+		t := time.Duration((1 - (limit-current)/c.previous) * float64(cl.window))
+		res.RetryAfter = t - elapsed
+	}
+	res.Remaining = int(math.Max(0, limit-c.previous*weight-current))
+	return res
+}
+
+// roll moves c to the fixed window containing now.
+func (cl *clusterLimiter) roll(c *clusterCounter, now time.Time) {
+	start := now.Truncate(cl.window)
+	if c.start.Equal(start) {
+		return
+	}
+	c.previous = 0
+	if c.start.Add(cl.window).Equal(start) {
+		c.previous = float64(c.count())
+	}
+	*c = clusterCounter{start: start, previous: c.previous}
+}
+
+func (c *clusterCounter) count() int64 {
+	return c.total + c.flushing + c.pending
+}
+
+// Sweep drops keys with nothing left to push whose windows can no longer
+// affect a decision.
+func (cl *clusterLimiter) Sweep(now time.Time) int {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	for key, c := range cl.counters {
+		if c.pending == 0 && c.flushing == 0 && now.Sub(c.start) >= 2*cl.window {
+			delete(cl.counters, key)
+		}
+	}
+	return len(cl.counters)
+}
+
+// sync pushes the pending counts to the backend, if the sync interval has
+// passed, and refreshes the cluster totals from the answers.
+func (cl *clusterLimiter) sync(now time.Time) {
+	type batch struct {
+		key   string
+		start time.Time
+		n     int64
+	}
+
+	cl.mu.Lock()
+	if cl.syncing || now.Sub(cl.lastSync) < cl.interval {
+		cl.mu.Unlock()
+		return
+	}
+	cl.syncing = true
+	cl.lastSync = now
+	var batches []batch
+	for key, c := range cl.counters {
+		if c.pending > 0 {
+			c.flushing, c.pending = c.pending, 0
+			batches = append(batches, batch{key, c.start, c.flushing})
+		}
+	}
+	cl.mu.Unlock()
+
+	var failed error
+	for _, b := range batches {
+		var total int64
+		err := failed
+		if err == nil {
+			ctx, cancel := context.WithTimeout(context.Background(), backendTimeout)
+			id := fmt.Sprintf("%s|%s|%d", cl.name, b.key, b.start.Unix())
+			total, err = cl.backend.Increment(ctx, id, b.n, b.start.Add(2*cl.window))
+			cancel()
+			failed = err
+		}
+
+		cl.mu.Lock()
+		if c, ok := cl.counters[b.key]; ok && c.start.Equal(b.start) {
+			if err != nil {
+				total = c.total + c.flushing // keep counting locally
+			}
+			c.total, c.flushing = total, 0
+		}
+		cl.mu.Unlock()
+	}
+
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+	cl.syncing = false
+	if len(batches) == 0 {
+		return
+	}
+	switch {
+	case failed != nil && !cl.degraded:
+		log.Printf("rate-limit: shared backend unreachable, limiting locally: %v", failed)
+		cl.degraded = true
+	case failed == nil && cl.degraded:
+		log.Printf("rate-limit: shared backend reachable again, limiting cluster-wide")
+		cl.degraded = false
+	}
+}
@@ -0,0 +1,150 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Result is the outcome of a rate limit check for one request.
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration // until the quota is fully restored
+	RetryAfter time.Duration // until the next request may be allowed, set when denied
+}
+
+// Limiter counts requests per key. Implementations must be safe for
+// concurrent use.
+type Limiter interface {
+	// Allow records a request for key at now and reports whether it may proceed.
+	Allow(key string, now time.Time) Result
+	// Sweep drops the state of keys idle at now and returns how many remain.
+	Sweep(now time.Time) int
+}
+
+// tokenBucket refills limit tokens per window up to burst, and every request
+// takes one token. It allows short bursts while enforcing the average rate.
+type tokenBucket struct {
+	limit int
+	burst float64
+	rate  float64 // tokens per second
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(limit, burst int, window time.Duration) *tokenBucket {
+	return &tokenBucket{
+		limit:   limit,
+		burst:   float64(burst),
+		rate:    float64(limit) / window.Seconds(),
+		buckets: map[string]*bucket{},
+	}
+}
+
+func (tb *tokenBucket) Allow(key string, now time.Time) Result {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	b, ok := tb.buckets[key]
+	if !ok {
+		b = &bucket{tokens: tb.burst, last: now}
+		tb.buckets[key] = b
+	}
+	b.tokens = math.Min(tb.burst, b.tokens+now.Sub(b.last).Seconds()*tb.rate)
+	b.last = now
+
+	res := Result{Limit: tb.limit}
+	if b.tokens >= 1 {
+		b.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = tb.until(1 - b.tokens)
+	}
+	res.Remaining = int(b.tokens)
+	res.Reset = tb.until(tb.burst - b.tokens)
+	return res
+}
+
+// until returns how long it takes to refill the given number of tokens.
+func (tb *tokenBucket) until(tokens float64) time.Duration {
+	return time.Duration(tokens / tb.rate * float64(time.Second))
+}
+
+// Sweep drops buckets that have refilled completely, since a new bucket
+// starts full anyway.
+func (tb *tokenBucket) Sweep(now time.Time) int {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+
+	for key, b := range tb.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*tb.rate >= tb.burst {
+			delete(tb.buckets, key)
+		}
+	}
+	return len(tb.buckets)
+}
+
+// slidingWindow keeps a log of request times per key and allows a request
+// if fewer than limit requests were allowed in the preceding window. It is
+// exact, at the cost of storing up to limit timestamps per key.
+type slidingWindow struct {
+	limit  int
+	window time.Duration
+
+	mu   sync.Mutex
+	logs map[string][]time.Time
+}
+
+func newSlidingWindow(limit int, window time.Duration) *slidingWindow {
+	return &slidingWindow{limit: limit, window: window, logs: map[string][]time.Time{}}
+}
+
+func (sw *slidingWindow) Allow(key string, now time.Time) Result {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+
+	times := sw.prune(sw.logs[key], now)
+	res := Result{Limit: sw.limit}
+	if len(times) < sw.limit {
+		times = append(times, now)
+		res.Allowed = true
+	} else {
+		res.RetryAfter = times[0].Add(sw.window).Sub(now)
+	}
+	sw.logs[key] = times
+	res.Remaining = sw.limit - len(times)
+	res.Reset = times[len(times)-1].Add(sw.window).Sub(now)
+	return res
+}
+
+// prune drops the timestamps that fell out of the window ending at now.
+func (sw *slidingWindow) prune(times []time.Time, now time.Time) []time.Time {
+	cutoff := now.Add(-sw.window)
+	i := 0
+	for i < len(times) && !times[i].After(cutoff) {
+		i++
+	}
+	return times[i:]
+}
+
+func (sw *slidingWindow) Sweep(now time.Time) int {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+
+	for key, times := range sw.logs {
+		if times = sw.prune(times, now); len(times) == 0 {
+			delete(sw.logs, key)
+		} else {
+			sw.logs[key] = times
+		}
+	}
+	return len(sw.logs)
+}
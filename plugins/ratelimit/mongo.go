@@ -0,0 +1,49 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoBackend keeps the counters in a MongoDB collection, one document per
+// key and window. A TTL index removes the documents of past windows.
+type MongoBackend struct {
+	collection *mongo.Collection
+}
+
+// NewMongoBackend creates a Backend storing its counters in the given
+// collection of db and makes sure the TTL index exists.
+func NewMongoBackend(db *mongo.Database, collection string) (*MongoBackend, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	coll := db.Collection(collection)
+	_, err := coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &MongoBackend{collection: coll}, nil
+}
+
+// Increment atomically adds n to the counter document, creating it if needed.
+func (m *MongoBackend) Increment(ctx context.Context, key string, n int64, expireAt time.Time) (int64, error) {
+	var doc struct {
+		Count int64 `bson:"count"`
+	}
+	err := m.collection.FindOneAndUpdate(ctx,
+		bson.M{"_id": key},
+		bson.M{
+			"$inc":         bson.M{"count": n},
+			"$setOnInsert": bson.M{"expires_at": expireAt},
+		},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&doc)
+	return doc.Count, err
+}
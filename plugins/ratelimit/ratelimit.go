@@ -0,0 +1,164 @@
+package ratelimit
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/alxmorales2020/api-gateway/config"
+	"github.com/alxmorales2020/api-gateway/core"
+)
+
+// Config is the per-route configuration of the rate-limit plugin.
+type Config struct {
+	Algorithm string          `json:"algorithm"` // token-bucket (default) or sliding-window
+	Limit     int             `json:"limit"`     // requests allowed per window
+	Window    config.Duration `json:"window"`    // default: 1s
+	Burst     int             `json:"burst"`     // token-bucket capacity, default: limit
+	Key       string          `json:"key"`       // ip (default), header, claim or route
+	KeyName   string          `json:"key_name"`  // header or claim name for key header/claim
+
+	Scope        string          `json:"scope"`         // local (default) or cluster
+	SyncInterval config.Duration `json:"sync_interval"` // cluster scope: how often counts are pushed, default: 250ms
+}
+
+// RateLimitPlugin rejects requests above the configured rate with 429.
+type RateLimitPlugin struct {
+	cfg       Config
+	signature string
+	create    func(key string) Limiter
+}
+
+// Name returns the name of the plugin.
+func (plugin *RateLimitPlugin) Name() string {
+	return "rate-limit"
+}
+
+// Init validates the configuration and applies defaults.
+func (plugin *RateLimitPlugin) Init(cfg map[string]interface{}) error {
+	var c Config
+	if err := core.DecodeConfig(cfg, &c); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+	if c.Limit <= 0 {
+		return errors.New("limit must be positive")
+	}
+	if c.Window <= 0 {
+		c.Window = config.Duration(time.Second)
+	}
+
+	switch c.Algorithm {
+	case "", "token-bucket":
+		c.Algorithm = "token-bucket"
+		if c.Burst <= 0 {
+			c.Burst = c.Limit
+		}
+		plugin.create = func(string) Limiter { return newTokenBucket(c.Limit, c.Burst, c.Window.Std()) }
+	case "sliding-window":
+		c.Burst = 0
+		plugin.create = func(string) Limiter { return newSlidingWindow(c.Limit, c.Window.Std()) }
+	default:
+		return fmt.Errorf("unknown algorithm %q (use token-bucket or sliding-window)", c.Algorithm)
+	}
+
+	switch c.Key {
+	case "", "ip":
+		c.Key = "ip"
+	case "header", "claim":
+		if c.KeyName == "" {
+			return fmt.Errorf("key %q requires key_name", c.Key)
+		}
+	case "route":
+	default:
+		return fmt.Errorf("unknown key %q (use ip, header, claim or route)", c.Key)
+	}
+
+	switch c.Scope {
+	case "", "local":
+		c.Scope = "local"
+		c.SyncInterval = 0
+	case "cluster":
+		if b := currentBackend(); b != nil {
+			// Cluster limits always use the sliding window counter, the
+			// algorithm only matters for the local fallback without backend.
+			plugin.create = func(key string) Limiter {
+				name := fmt.Sprintf("%08x", crc32.ChecksumIEEE([]byte(key)))
+				return newClusterLimiter(name, c.Limit, c.Window.Std(), c.SyncInterval.Std(), b)
+			}
+		} else {
+			// Warn when the limiter is created rather than here, so router
+			// reloads that keep the config do not repeat it.
+			local := plugin.create
+			plugin.create = func(key string) Limiter {
+				log.Printf("rate-limit: scope cluster without a shared backend, limiting locally")
+				return local(key)
+			}
+		}
+	default:
+		return fmt.Errorf("unknown scope %q (use local or cluster)", c.Scope)
+	}
+
+	plugin.cfg = c
+	plugin.signature = fmt.Sprintf("%+v", c)
+	return nil
+}
+
+// Execute counts the request against its key's limit. Every response carries
+// the RateLimit-* headers; requests over the limit get 429 with Retry-After.
+func (plugin *RateLimitPlugin) Execute(writer http.ResponseWriter, request *http.Request) error {
+	rc := core.GetRequestContext(request)
+	route := ""
+	if rc != nil {
+		route = rc.Route.Key()
+	}
+	// The config is part of the key, so changing the limit starts fresh
+	// counters while an unchanged route keeps its own across reloads.
+	limiter := sharedLimiter(route+"|"+plugin.signature, plugin.create)
+	res := limiter.Allow(plugin.key(request, rc), time.Now())
+
+	header := writer.Header()
+	header.Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+	header.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	header.Set("RateLimit-Reset", seconds(res.Reset))
+	if !res.Allowed {
+		header.Set("Retry-After", seconds(res.RetryAfter))
+		http.Error(writer, "Too Many Requests: rate limit exceeded", http.StatusTooManyRequests)
+		return errors.New("rate limit exceeded")
+	}
+	return nil
+}
+
+// key returns the value requests are counted by. Requests without the
+// configured header or claim are counted by client IP instead.
+func (plugin *RateLimitPlugin) key(request *http.Request, rc *core.RequestContext) string {
+	switch plugin.cfg.Key {
+	case "route":
+		return "route"
+	case "header":
+		if value := request.Header.Get(plugin.cfg.KeyName); value != "" {
+			return "header:" + value
+		}
+	case "claim":
+		if rc != nil {
+			if value, ok := rc.Claims[plugin.cfg.KeyName]; ok {
+				return fmt.Sprintf("claim:%v", value)
+			}
+		}
+	}
+	return "ip:" + core.ClientIP(request)
+}
+
+// seconds formats d as whole seconds, rounded up.
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+// Register the plugin with the core plugin manager
+func New() core.Plugin {
+	return &RateLimitPlugin{}
+}
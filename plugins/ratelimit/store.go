@@ -0,0 +1,64 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	sweepInterval = time.Minute
+	syncTick      = 50 * time.Millisecond
+)
+
+var (
+	limitersMu sync.Mutex
+	limiters   = map[string]Limiter{}
+	sweeper    sync.Once
+)
+
+// sharedLimiter returns the limiter registered under key, creating it with
+// create if needed. Limiters live outside the plugin instances, so a router
+// reload that keeps a route's limit config keeps its counters too.
+func sharedLimiter(key string, create func(key string) Limiter) Limiter {
+	sweeper.Do(func() {
+		go sweep()
+		go syncClusters()
+	})
+
+	limitersMu.Lock()
+	defer limitersMu.Unlock()
+
+	l, ok := limiters[key]
+	if !ok {
+		l = create(key)
+		limiters[key] = l
+	}
+	return l
+}
+
+// sweep periodically drops idle keys, and limiters left without any keys,
+// e.g. those of deleted routes or replaced configs.
+func sweep() {
+	for now := range time.Tick(sweepInterval) {
+		limitersMu.Lock()
+		for key, l := range limiters {
+			if l.Sweep(now) == 0 {
+				delete(limiters, key)
+			}
+		}
+		limitersMu.Unlock()
+	}
+}
+
+// syncClusters drives the batched backend sync of the cluster-scoped limiters.
+func syncClusters() {
+	for now := range time.Tick(syncTick) {
+		limitersMu.Lock()
+		for _, l := range limiters {
+			if cl, ok := l.(*clusterLimiter); ok {
+				go cl.sync(now)
+			}
+		}
+		limitersMu.Unlock()
+	}
+}
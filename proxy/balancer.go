@@ -0,0 +1,243 @@
+package proxy
+
+import (
+	"fmt"
+	"hash/crc32"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/alxmorales2020/api-gateway/config"
+	"github.com/alxmorales2020/api-gateway/core"
+)
+
+// Target is a single upstream server of a route.
+type Target struct {
+	URL    *url.URL
+	Weight int
+
+	active  int64 // in-flight requests
+	current int   // smooth weighted round-robin state, guarded by the balancer
+	health  *health
+}
+
+// TargetStatus is a point-in-time view of a target for the admin API.
+type TargetStatus struct {
+	URL       string    `json:"url"`
+	Weight    int       `json:"weight"`
+	Healthy   bool      `json:"healthy"`
+	Active    int64     `json:"active_requests"`
+	LastCheck time.Time `json:"last_check,omitempty"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+// Active returns the number of requests currently in flight to the target.
+func (t *Target) Active() int64 {
+	return atomic.LoadInt64(&t.active)
+}
+
+// Status returns the target's current health and load.
+func (t *Target) Status() TargetStatus {
+	t.health.mu.Lock()
+	defer t.health.mu.Unlock()
+	return TargetStatus{
+		URL:       t.URL.String(),
+		Weight:    t.Weight,
+		Healthy:   t.health.healthy,
+		Active:    t.Active(),
+		LastCheck: t.health.lastCheck,
+		LastError: t.health.lastError,
+	}
+}
+
+// Balancer picks the target for a request among the given candidates.
+// Candidates is never empty.
+type Balancer interface {
+	Pick(r *http.Request, candidates []*Target) *Target
+}
+
+// NewBalancer creates the balancer named in the pool config over targets.
+func NewBalancer(pool *config.UpstreamPool, targets []*Target) (Balancer, error) {
+	name := ""
+	if pool != nil {
+		name = pool.Balancer
+	}
+	switch name {
+	case "", "round-robin":
+		return &roundRobin{}, nil
+	case "weighted-round-robin":
+		return &weightedRoundRobin{}, nil
+	case "least-connections":
+		return &leastConnections{}, nil
+	case "random-two-choices":
+		return &randomTwoChoices{}, nil
+	case "consistent-hash":
+		switch pool.HashOn {
+		case "ip":
+		case "header", "cookie":
+			if pool.HashKey == "" {
+				return nil, fmt.Errorf("hash_on %q requires hash_key", pool.HashOn)
+			}
+		default:
+			return nil, fmt.Errorf("consistent-hash: unknown hash_on %q (use header, cookie or ip)", pool.HashOn)
+		}
+		return newConsistentHash(pool.HashOn, pool.HashKey, targets), nil
+	}
+	return nil, fmt.Errorf("unknown balancer %q", name)
+}
+
+type roundRobin struct {
+	next uint64
+}
+
+func (b *roundRobin) Pick(_ *http.Request, candidates []*Target) *Target {
+	n := atomic.AddUint64(&b.next, 1)
+	return candidates[(n-1)%uint64(len(candidates))]
+}
+
+// weightedRoundRobin is nginx's smooth weighted round-robin: it spreads the
+// picks of heavier targets evenly instead of sending them in bursts.
+type weightedRoundRobin struct {
+	mu sync.Mutex
+}
+
+func (b *weightedRoundRobin) Pick(_ *http.Request, candidates []*Target) *Target {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var best *Target
+	total := 0
+	for _, t := range candidates {
+		t.current += t.Weight
+		total += t.Weight
+		if best == nil || t.current > best.current {
+			best = t
+		}
+	}
+	best.current -= total
+	return best
+}
+
+// leastConnections picks the target with the fewest in-flight requests
+// relative to its weight.
+type leastConnections struct {
+	roundRobin
+}
+
+func (b *leastConnections) Pick(r *http.Request, candidates []*Target) *Target {
+	// Start from a rotating offset so ties do not always go to the first target.
+	start := b.roundRobin.Pick(r, candidates)
+	best := start
+	for _, t := range candidates {
+		if t.Active()*int64(best.Weight) < best.Active()*int64(t.Weight) {
+			best = t
+		}
+	}
+	return best
+}
+
+// randomTwoChoices samples two targets at random, weighted, and picks the one
+// with fewer in-flight requests.
+type randomTwoChoices struct{}
+
+func (b *randomTwoChoices) Pick(_ *http.Request, candidates []*Target) *Target {
+	if len(candidates) == 1 {
+		return candidates[0]
+	}
+	first := weightedRandom(candidates)
+	second := weightedRandom(candidates)
+	for i := 0; second == first && i < 3; i++ {
+		second = weightedRandom(candidates)
+	}
+	if second.Active()*int64(first.Weight) < first.Active()*int64(second.Weight) {
+		return second
+	}
+	return first
+}
+
+func weightedRandom(candidates []*Target) *Target {
+	total := 0
+	for _, t := range candidates {
+		total += t.Weight
+	}
+	n := rand.Intn(total)
+	for _, t := range candidates {
+		if n < t.Weight {
+			return t
+		}
+		n -= t.Weight
+	}
+	return candidates[len(candidates)-1]
+}
+
+// consistentHash maps a request key onto a hash ring with virtual nodes in
+// proportion to target weight, so a key keeps hitting the same target while
+// the target set is stable.
+type consistentHash struct {
+	hashOn   string
+	hashKey  string
+	ring     []uint32
+	owners   map[uint32]*Target
+	fallback roundRobin
+}
+
+const virtualNodesPerWeight = 100
+
+func newConsistentHash(hashOn, hashKey string, targets []*Target) *consistentHash {
+	b := &consistentHash{hashOn: hashOn, hashKey: hashKey, owners: map[uint32]*Target{}}
+	for _, t := range targets {
+		for i := 0; i < t.Weight*virtualNodesPerWeight; i++ {
+			h := crc32.ChecksumIEEE([]byte(t.URL.String() + "#" + strconv.Itoa(i)))
+			if _, taken := b.owners[h]; taken {
+				continue
+			}
+			b.owners[h] = t
+			b.ring = append(b.ring, h)
+		}
+	}
+	sort.Slice(b.ring, func(i, j int) bool { return b.ring[i] < b.ring[j] })
+	return b
+}
+
+func (b *consistentHash) Pick(r *http.Request, candidates []*Target) *Target {
+	key := b.key(r)
+	if key == "" || len(b.ring) == 0 {
+		return b.fallback.Pick(r, candidates)
+	}
+
+	allowed := make(map[*Target]bool, len(candidates))
+	for _, t := range candidates {
+		allowed[t] = true
+	}
+
+	// Walk clockwise from the key's position to the first allowed target, so
+	// keys of an excluded target move to its neighbours only.
+	h := crc32.ChecksumIEEE([]byte(key))
+	start := sort.Search(len(b.ring), func(i int) bool { return b.ring[i] >= h })
+	for i := 0; i < len(b.ring); i++ {
+		t := b.owners[b.ring[(start+i)%len(b.ring)]]
+		if allowed[t] {
+			return t
+		}
+	}
+	return b.fallback.Pick(r, candidates)
+}
+
+func (b *consistentHash) key(r *http.Request) string {
+	switch b.hashOn {
+	case "header":
+		return r.Header.Get(b.hashKey)
+	case "cookie":
+		if c, err := r.Cookie(b.hashKey); err == nil {
+			return c.Value
+		}
+		return ""
+	default:
+		return core.ClientIP(r)
+	}
+}
@@ -0,0 +1,270 @@
+package proxy
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/alxmorales2020/api-gateway/config"
+)
+
+const (
+	defaultBreakerFailures    = 5
+	defaultBreakerWindow      = 10 * time.Second
+	defaultBreakerMinRequests = 20
+	defaultBreakerOpen        = 30 * time.Second
+	defaultBreakerBody        = "Upstream error: circuit breaker open"
+	breakerBuckets            = 10
+)
+
+type breakerState int
+
+const (
+	stateClosed breakerState = iota
+	stateOpen
+	stateHalfOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case stateOpen:
+		return "open"
+	case stateHalfOpen:
+		return "half-open"
+	}
+	return "closed"
+}
+
+// BreakerStatus is a point-in-time view of a circuit breaker for the admin API.
+type BreakerStatus struct {
+	State               string    `json:"state"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	WindowRequests      int       `json:"window_requests"`
+	WindowFailures      int       `json:"window_failures"`
+	OpenedAt            time.Time `json:"opened_at,omitempty"`
+	ChangedAt           time.Time `json:"changed_at,omitempty"`
+}
+
+type breakerBucket struct {
+	start    time.Time
+	requests int
+	failures int
+}
+
+// circuitBreaker guards a route's upstream. In the closed state requests flow
+// and outcomes are counted; once the thresholds are crossed it opens and
+// rejects requests for OpenDuration, then lets HalfOpenRequests trial requests
+// through and closes again only if all of them succeed.
+type circuitBreaker struct {
+	name string
+	cfg  config.CircuitBreakerConfig
+
+	mu          sync.Mutex
+	state       breakerState
+	consecutive int
+	buckets     [breakerBuckets]breakerBucket
+	openedAt    time.Time
+	changedAt   time.Time
+	inFlight    int // half-open trial requests in flight
+	trialOK     int // successful half-open trial requests
+}
+
+var breakerRegistry = newRegistry[*circuitBreaker]()
+
+// acquireBreaker returns the shared breaker for a route. The config is part of
+// the key, so changing it starts from a fresh, closed breaker.
+func acquireBreaker(name string, cfg *config.CircuitBreakerConfig) (*circuitBreaker, string) {
+	fresh := newBreaker(name, cfg)
+	key := fmt.Sprintf("%s|%+v", name, fresh.cfg)
+	return breakerRegistry.acquire(key, func() *circuitBreaker { return fresh }), key
+}
+
+// newBreaker returns a closed breaker for cfg with its defaults applied. It
+// is not shared with any other proxy.
+func newBreaker(name string, cfg *config.CircuitBreakerConfig) *circuitBreaker {
+	c := *cfg
+	if c.ConsecutiveFailures <= 0 && c.ErrorRatio <= 0 {
+		c.ConsecutiveFailures = defaultBreakerFailures
+	}
+	if c.Window <= 0 {
+		c.Window = config.Duration(defaultBreakerWindow)
+	}
+	if c.MinRequests <= 0 {
+		c.MinRequests = defaultBreakerMinRequests
+	}
+	if c.OpenDuration <= 0 {
+		c.OpenDuration = config.Duration(defaultBreakerOpen)
+	}
+	if c.HalfOpenRequests <= 0 {
+		c.HalfOpenRequests = 1
+	}
+	if len(c.Statuses) == 0 {
+		c.Statuses = defaultPassiveStatuses
+	}
+	if c.OpenStatus == 0 {
+		c.OpenStatus = http.StatusServiceUnavailable
+	}
+	if c.OpenBody == "" {
+		c.OpenBody = defaultBreakerBody
+	}
+
+	return &circuitBreaker{name: name, cfg: c}
+}
+
+// allow reports whether a request may be sent upstream. Every allowed request
+// must be followed by a call to record or cancel.
+func (cb *circuitBreaker) allow() bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	switch cb.state {
+	case stateOpen:
+		if time.Since(cb.openedAt) < cb.cfg.OpenDuration.Std() {
+			return false
+		}
+		cb.transition(stateHalfOpen)
+		fallthrough
+	case stateHalfOpen:
+		if cb.inFlight+cb.trialOK >= cb.cfg.HalfOpenRequests {
+			return false
+		}
+		cb.inFlight++
+		return true
+	}
+	return true
+}
+
+// record reports the outcome of an allowed request.
+func (cb *circuitBreaker) record(success bool) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if cb.state == stateHalfOpen {
+		if cb.inFlight == 0 {
+			return // started before the breaker opened
+		}
+		cb.inFlight--
+		if !success {
+			cb.trip()
+			return
+		}
+		cb.trialOK++
+		if cb.trialOK >= cb.cfg.HalfOpenRequests {
+			cb.transition(stateClosed)
+		}
+		return
+	}
+	if cb.state != stateClosed {
+		return
+	}
+
+	bucket := cb.bucket(time.Now())
+	bucket.requests++
+	if success {
+		cb.consecutive = 0
+		return
+	}
+	bucket.failures++
+	cb.consecutive++
+
+	if cb.cfg.ConsecutiveFailures > 0 && cb.consecutive >= cb.cfg.ConsecutiveFailures {
+		cb.trip()
+		return
+	}
+	if cb.cfg.ErrorRatio > 0 {
+		requests, failures := cb.windowCounts()
+		if requests >= cb.cfg.MinRequests && float64(failures)/float64(requests) >= cb.cfg.ErrorRatio {
+			cb.trip()
+		}
+	}
+}
+
+// failure reports whether an upstream outcome counts against the breaker.
+func (cb *circuitBreaker) failure(statusCode int, err error) bool {
+	return err != nil || containsStatus(cb.cfg.Statuses, statusCode)
+}
+
+// cancel releases an allowed request whose outcome says nothing about the
+// upstream, e.g. because the client went away.
+func (cb *circuitBreaker) cancel() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if cb.state == stateHalfOpen && cb.inFlight > 0 {
+		cb.inFlight--
+	}
+}
+
+// reject writes the configured fail-fast response.
+func (cb *circuitBreaker) reject(w http.ResponseWriter) {
+	cb.mu.Lock()
+	retryAfter := time.Until(cb.openedAt.Add(cb.cfg.OpenDuration.Std()))
+	cb.mu.Unlock()
+
+	if retryAfter > 0 {
+		w.Header().Set("Retry-After", fmt.Sprint(int(retryAfter.Seconds())+1))
+	}
+	http.Error(w, cb.cfg.OpenBody, cb.cfg.OpenStatus)
+}
+
+func (cb *circuitBreaker) status() BreakerStatus {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	requests, failures := cb.windowCounts()
+	return BreakerStatus{
+		State:               cb.state.String(),
+		ConsecutiveFailures: cb.consecutive,
+		WindowRequests:      requests,
+		WindowFailures:      failures,
+		OpenedAt:            cb.openedAt,
+		ChangedAt:           cb.changedAt,
+	}
+}
+
+func (cb *circuitBreaker) trip() {
+	cb.openedAt = time.Now()
+	cb.transition(stateOpen)
+}
+
+func (cb *circuitBreaker) transition(to breakerState) {
+	if cb.state == to {
+		return
+	}
+	log.Printf("upstream %s: circuit breaker %s -> %s", cb.name, cb.state, to)
+	cb.state = to
+	cb.changedAt = time.Now()
+	cb.consecutive = 0
+	cb.inFlight = 0
+	cb.trialOK = 0
+	if to == stateClosed {
+		cb.buckets = [breakerBuckets]breakerBucket{}
+	}
+}
+
+// bucket returns the window bucket for now, recycling expired buckets.
+func (cb *circuitBreaker) bucket(now time.Time) *breakerBucket {
+	width := cb.cfg.Window.Std() / breakerBuckets
+	if width <= 0 {
+		width = time.Millisecond
+	}
+	start := now.Truncate(width)
+	b := &cb.buckets[(start.UnixNano()/int64(width))%breakerBuckets]
+	if !b.start.Equal(start) {
+		*b = breakerBucket{start: start}
+	}
+	return b
+}
+
+func (cb *circuitBreaker) windowCounts() (requests, failures int) {
+	cutoff := time.Now().Add(-cb.cfg.Window.Std())
+	for _, b := range cb.buckets {
+		if b.start.After(cutoff) {
+			requests += b.requests
+			failures += b.failures
+		}
+	}
+	return requests, failures
+}
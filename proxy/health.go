@@ -0,0 +1,271 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/alxmorales2020/api-gateway/config"
+)
+
+const (
+	defaultCheckInterval      = 10 * time.Second
+	defaultCheckTimeout       = 2 * time.Second
+	defaultHealthyThreshold   = 2
+	defaultUnhealthyThreshold = 3
+	defaultPassiveThreshold   = 5
+	defaultPassiveCooldown    = 30 * time.Second
+)
+
+var defaultPassiveStatuses = []int{
+	http.StatusInternalServerError,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// health is the health state of a target. It is shared by every proxy built
+// for the same route and target, so a router reload does not forget which
+// targets are down.
+type health struct {
+	mu             sync.Mutex
+	healthy        bool
+	successes      int // consecutive, while unhealthy
+	failures       int // consecutive, while healthy
+	unhealthySince time.Time
+	lastCheck      time.Time
+	lastError      string
+}
+
+var healthRegistry = newRegistry[*health]()
+
+func newHealth() *health {
+	return &health{healthy: true}
+}
+
+// healthChecker applies a pool's health check config to its targets.
+type healthChecker struct {
+	name    string
+	active  *config.ActiveHealthCheck
+	passive *config.PassiveHealthCheck
+	client  *http.Client
+	stop    chan struct{}
+	done    sync.WaitGroup
+}
+
+func newHealthChecker(name string, cfg *config.HealthCheckConfig) (*healthChecker, error) {
+	hc := &healthChecker{name: name, stop: make(chan struct{})}
+	if cfg == nil {
+		return hc, nil
+	}
+
+	if cfg.Active != nil {
+		active := *cfg.Active
+		switch active.Type {
+		case "":
+			active.Type = "http"
+		case "http", "tcp":
+		default:
+			return nil, fmt.Errorf("health_check.active.type: unknown type %q (use http or tcp)", active.Type)
+		}
+		if active.Path == "" {
+			active.Path = "/"
+		}
+		if active.Interval <= 0 {
+			active.Interval = config.Duration(defaultCheckInterval)
+		}
+		if active.Timeout <= 0 {
+			active.Timeout = config.Duration(defaultCheckTimeout)
+		}
+		if active.HealthyThreshold <= 0 {
+			active.HealthyThreshold = defaultHealthyThreshold
+		}
+		if active.UnhealthyThreshold <= 0 {
+			active.UnhealthyThreshold = defaultUnhealthyThreshold
+		}
+		hc.active = &active
+		hc.client = &http.Client{
+			Timeout: active.Timeout.Std(),
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		}
+	}
+
+	if cfg.Passive != nil {
+		passive := *cfg.Passive
+		if passive.UnhealthyThreshold <= 0 {
+			passive.UnhealthyThreshold = defaultPassiveThreshold
+		}
+		if len(passive.Statuses) == 0 {
+			passive.Statuses = defaultPassiveStatuses
+		}
+		if passive.Cooldown <= 0 {
+			passive.Cooldown = config.Duration(defaultPassiveCooldown)
+		}
+		hc.passive = &passive
+	}
+	return hc, nil
+}
+
+// start launches the active probes, if configured.
+func (hc *healthChecker) start(targets []*Target) {
+	if hc.active == nil {
+		return
+	}
+	hc.done.Add(1)
+	go func() {
+		defer hc.done.Done()
+		ticker := time.NewTicker(hc.active.Interval.Std())
+		defer ticker.Stop()
+
+		for {
+			hc.probeAll(targets)
+			select {
+			case <-hc.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (hc *healthChecker) close() {
+	close(hc.stop)
+	hc.done.Wait()
+}
+
+func (hc *healthChecker) probeAll(targets []*Target) {
+	var wg sync.WaitGroup
+	for _, t := range targets {
+		wg.Add(1)
+		go func(t *Target) {
+			defer wg.Done()
+			err := hc.probe(t)
+			hc.record(t, err == nil, err, hc.active.HealthyThreshold, hc.active.UnhealthyThreshold, "active")
+		}(t)
+	}
+	wg.Wait()
+}
+
+func (hc *healthChecker) probe(t *Target) error {
+	if hc.active.Type == "tcp" {
+		conn, err := net.DialTimeout("tcp", hostPort(t.URL.Scheme, t.URL.Host), hc.active.Timeout.Std())
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), hc.active.Timeout.Std())
+	defer cancel()
+	probeURL := *t.URL
+	probeURL.Path = singleJoiningSlash(t.URL.Path, hc.active.Path)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, probeURL.String(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := hc.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if len(hc.active.ExpectedStatuses) == 0 {
+		if resp.StatusCode >= 200 && resp.StatusCode < 400 {
+			return nil
+		}
+	} else if containsStatus(hc.active.ExpectedStatuses, resp.StatusCode) {
+		return nil
+	}
+	return fmt.Errorf("unexpected status %d", resp.StatusCode)
+}
+
+// observe records the outcome of a proxied request for passive checks. err is
+// set when the request failed before a response arrived.
+func (hc *healthChecker) observe(t *Target, statusCode int, err error) {
+	if hc.passive == nil {
+		return
+	}
+	if err == nil && containsStatus(hc.passive.Statuses, statusCode) {
+		err = fmt.Errorf("upstream returned %d", statusCode)
+	}
+	// Passive checks never need more than one success to recover: the
+	// target only receives traffic again once its cooldown expired.
+	hc.record(t, err == nil, err, 1, hc.passive.UnhealthyThreshold, "passive")
+}
+
+func (hc *healthChecker) record(t *Target, ok bool, err error, healthyThreshold, unhealthyThreshold int, source string) {
+	h := t.health
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.lastCheck = time.Now()
+	if err != nil {
+		h.lastError = err.Error()
+	}
+
+	if ok {
+		h.failures = 0
+		if !h.healthy {
+			h.successes++
+			if h.successes >= healthyThreshold {
+				h.healthy = true
+				h.successes = 0
+				h.lastError = ""
+				log.Printf("upstream %s: target %s is healthy again (%s check)", hc.name, t.URL, source)
+			}
+		}
+		return
+	}
+
+	h.successes = 0
+	if h.healthy {
+		h.failures++
+		if h.failures >= unhealthyThreshold {
+			h.healthy = false
+			h.failures = 0
+			h.unhealthySince = time.Now()
+			log.Printf("upstream %s: target %s marked unhealthy (%s check): %v", hc.name, t.URL, source, err)
+		}
+	} else {
+		h.unhealthySince = time.Now()
+	}
+}
+
+// available reports whether t may receive traffic.
+func (hc *healthChecker) available(t *Target) bool {
+	h := t.health
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.healthy || (hc.active == nil && hc.passive == nil) {
+		return true
+	}
+	// Without active probes nothing would ever bring the target back, so
+	// let traffic test it again once the passive cooldown has passed.
+	return hc.active == nil && hc.passive != nil && time.Since(h.unhealthySince) >= hc.passive.Cooldown.Std()
+}
+
+func containsStatus(statuses []int, code int) bool {
+	for _, s := range statuses {
+		if s == code {
+			return true
+		}
+	}
+	return false
+}
+
+func hostPort(scheme, host string) string {
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+	if scheme == "https" {
+		return net.JoinHostPort(host, "443")
+	}
+	return net.JoinHostPort(host, "80")
+}
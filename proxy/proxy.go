@@ -1,39 +1,378 @@
 package proxy
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
 	"net/http"
+	"net/http/httptrace"
 	"net/http/httputil"
 	"net/url"
 	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/alxmorales2020/api-gateway/config"
+	"github.com/alxmorales2020/api-gateway/core"
 )
 
-func NewReverseProxy(target string, stripPrefix string) (*httputil.ReverseProxy, error) {
-	// Parse the target URL
-	targetURL, err := url.Parse(target)
+// Proxy forwards requests for a route to one of its upstream targets.
+// Close must be called once the proxy is no longer used.
+type Proxy struct {
+	targets    []*Target
+	healthKeys []string
+	balancer   Balancer
+	health     *healthChecker
+	breaker    *circuitBreaker // nil without a circuit_breaker config
+	breakerKey string
+	retry      *retryPolicy // nil without a retry config
+	deadline   time.Duration
+	transport  *http.Transport
+	reverse    *httputil.ReverseProxy
+	detached   bool // health and breaker state are private, see NewDetachedProxy
+}
+
+// ErrNoHealthyUpstream is reported when every target of a route is unhealthy.
+var ErrNoHealthyUpstream = errors.New("no healthy upstream")
+
+// attempt tracks one request to an upstream target. It travels in the
+// outgoing request's context so the ReverseProxy hooks can record the outcome.
+type attempt struct {
+	target     *Target
+	statusCode int
+	err        error
+
+	retryable bool // a failure may be retried instead of sent to the client
+	retrying  bool // the outcome was dropped and the request will be retried
+
+	phase int32 // how far the request got, see trace
+}
+
+type attemptKey struct{}
+
+func attemptFrom(r *http.Request) *attempt {
+	a, _ := r.Context().Value(attemptKey{}).(*attempt)
+	return a
+}
+
+// NewReverseProxy builds the proxy for a route. stripPrefix, if not empty, is
+// removed from the request path before the route's rewrite rules run and the
+// result is joined with the target's path.
+func NewReverseProxy(route config.RouteConfig, stripPrefix string) (*Proxy, error) {
+	return newReverseProxy(route, stripPrefix, false)
+}
+
+// NewDetachedProxy builds the proxy for a route like NewReverseProxy, but
+// runs no active health checks and keeps its target health and circuit
+// breaker to itself, so building it touches neither the upstreams nor the
+// state of the proxies serving them. It is meant for checking a route
+// config without putting it into service.
+func NewDetachedProxy(route config.RouteConfig, stripPrefix string) (*Proxy, error) {
+	return newReverseProxy(route, stripPrefix, true)
+}
+
+func newReverseProxy(route config.RouteConfig, stripPrefix string, detached bool) (*Proxy, error) {
+	upstreams := route.Targets()
+	if len(upstreams) == 0 {
+		return nil, errors.New("no upstream configured")
+	}
+
+	name := route.ID
+	if name == "" {
+		name = route.Path
+	}
+	var healthConfig *config.HealthCheckConfig
+	if route.Pool != nil {
+		healthConfig = route.Pool.HealthCheck
+	}
+	checker, err := newHealthChecker(name, healthConfig)
 	if err != nil {
 		return nil, err
 	}
 
-	// Create a new reverse proxy
-	proxy := httputil.NewSingleHostReverseProxy(targetURL)
+	targets := make([]*Target, 0, len(upstreams))
+	for _, upstream := range upstreams {
+		// Parse the target URL
+		targetURL, err := url.Parse(upstream.URL)
+		if err != nil {
+			return nil, err
+		}
+		if targetURL.Scheme == "" || targetURL.Host == "" {
+			return nil, fmt.Errorf("upstream %q must be an absolute URL", upstream.URL)
+		}
+		weight := upstream.EffectiveWeight()
+		if weight < 0 {
+			return nil, fmt.Errorf("upstream %q: weight must not be negative", upstream.URL)
+		}
+		targets = append(targets, &Target{URL: targetURL, Weight: weight})
+	}
+
+	balancer, err := NewBalancer(route.Pool, targets)
+	if err != nil {
+		return nil, err
+	}
+	retry, err := newRetryPolicy(route.Retry)
+	if err != nil {
+		return nil, err
+	}
+	rewrite, err := newRewriter(route.Rewrite, stripPrefix)
+	if err != nil {
+		return nil, err
+	}
 
-	// Modify the request before sending it to the target
-	originalDirector := proxy.Director
-	proxy.Director = func(req *http.Request) {
-		// Call the original director to set the target URL
-		originalDirector(req)
+	p := &Proxy{
+		targets:   targets,
+		balancer:  balancer,
+		health:    checker,
+		retry:     retry,
+		transport: newTransport(route.Timeouts),
+		detached:  detached,
+	}
+	if route.Timeouts != nil {
+		p.deadline = route.Timeouts.Request.Std()
+	}
+	for _, t := range targets {
+		if detached {
+			t.health = newHealth()
+			continue
+		}
+		key := name + "|" + t.URL.String()
+		t.health = healthRegistry.acquire(key, newHealth)
+		p.healthKeys = append(p.healthKeys, key)
+	}
+	if route.CircuitBreaker != nil {
+		if detached {
+			p.breaker = newBreaker(name, route.CircuitBreaker)
+		} else {
+			p.breaker, p.breakerKey = acquireBreaker(name, route.CircuitBreaker)
+		}
+	}
+	p.reverse = &httputil.ReverseProxy{
+		Transport: p.transport,
+		// Modify the request before sending it to the target
+		Director: func(req *http.Request) {
+			target := attemptFrom(req).target
 
-		req.Host = targetURL.Host
-		if stripPrefix != "" && strings.HasPrefix(req.URL.Path, stripPrefix) {
-			req.URL.Path = strings.TrimPrefix(req.URL.Path, stripPrefix)
-			if req.URL.Path == "" {
-				req.URL.Path = "/"
+			rewrite.apply(req)
+			rewriteRequestURL(req, target.URL)
+			req.Host = target.URL.Host
+		},
+		ModifyResponse: func(resp *http.Response) error {
+			a := attemptFrom(resp.Request)
+			a.statusCode = resp.StatusCode
+			if a.retryable && p.retry.retriesStatus(resp.StatusCode) && p.retry.budget.take() {
+				a.retrying = true
+				return errRetryableStatus
+			}
+			return core.UpstreamResponse(resp)
+		},
+		ErrorHandler: func(writer http.ResponseWriter, request *http.Request, err error) {
+			a := attemptFrom(request)
+			if a.retrying {
+				return // response dropped by ModifyResponse
+			}
+			a.err = err
+			if a.retryable && request.Context().Err() == nil && p.retry.retriesError(err) && p.retry.budget.take() {
+				a.retrying = true
+				return
+			}
+			if kind := timeoutKind(request, err); kind != "" {
+				writeTimeout(writer, kind)
+				return
 			}
+			http.Error(writer, "Upstream error: "+err.Error(), http.StatusBadGateway)
+		},
+	}
+	if !detached {
+		checker.start(targets)
+	}
+	return p, nil
+}
+
+// Close stops the proxy's active health checks and drops its idle connections.
+func (p *Proxy) Close() {
+	p.health.close()
+	p.transport.CloseIdleConnections()
+	for _, key := range p.healthKeys {
+		healthRegistry.release(key)
+	}
+	if p.breaker != nil && !p.detached {
+		breakerRegistry.release(p.breakerKey)
+	}
+}
+
+// BreakerStatus reports the circuit breaker state, or nil if the route has none.
+func (p *Proxy) BreakerStatus() *BreakerStatus {
+	if p.breaker == nil {
+		return nil
+	}
+	status := p.breaker.status()
+	return &status
+}
+
+// Status reports the health and load of every target.
+func (p *Proxy) Status() []TargetStatus {
+	out := make([]TargetStatus, 0, len(p.targets))
+	for _, t := range p.targets {
+		out = append(out, t.Status())
+	}
+	return out
+}
+
+// Targets returns the proxy's upstream targets.
+func (p *Proxy) Targets() []*Target {
+	return p.targets
+}
+
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if p.deadline > 0 {
+		ctx, cancel := context.WithTimeout(r.Context(), p.deadline)
+		defer cancel()
+		r = r.WithContext(ctx)
+	}
+
+	var replay func() io.ReadCloser
+	if p.retry != nil {
+		p.retry.budget.deposit()
+		var err error
+		if replay, err = p.retry.replayable(r); err != nil {
+			http.Error(w, "Failed to read request body", http.StatusBadRequest)
+			return
 		}
 	}
 
-	proxy.ErrorHandler = func(writer http.ResponseWriter, request *http.Request, err error) {
-		http.Error(writer, "Upstream error: "+err.Error(), http.StatusBadGateway)
+	tried := map[*Target]bool{}
+	for n := 1; ; n++ {
+		if p.breaker != nil && !p.breaker.allow() {
+			p.breaker.reject(w)
+			return
+		}
+
+		candidates := p.available(tried)
+		if len(candidates) == 0 {
+			if p.breaker != nil {
+				p.breaker.record(false)
+			}
+			http.Error(w, "Upstream error: "+ErrNoHealthyUpstream.Error(), http.StatusServiceUnavailable)
+			return
+		}
+
+		a := &attempt{
+			target:    p.balancer.Pick(r, candidates),
+			retryable: replay != nil && n < p.retry.attempts,
+		}
+		ctx := context.WithValue(r.Context(), attemptKey{}, a)
+		req := r.WithContext(httptrace.WithClientTrace(ctx, a.trace()))
+		if replay != nil {
+			req.Body = replay()
+		}
+
+		atomic.AddInt64(&a.target.active, 1)
+		p.reverse.ServeHTTP(w, req)
+		atomic.AddInt64(&a.target.active, -1)
+
+		p.observe(r, a)
+		if !a.retrying {
+			return
+		}
+		tried[a.target] = true
+
+		delay := p.retry.delay(n)
+		log.Printf("upstream %s failed (status %d, err %v), retry %d in %v", a.target.URL, a.statusCode, a.err, n, delay)
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			if errors.Is(r.Context().Err(), context.DeadlineExceeded) {
+				writeTimeout(w, timeoutKind(r, r.Context().Err()))
+			}
+			return
+		}
+	}
+}
+
+// observe feeds the outcome of an attempt to passive health checks and the
+// circuit breaker. Attempts aborted by the client say nothing about the
+// upstream and are not counted.
+func (p *Proxy) observe(r *http.Request, a *attempt) {
+	if a.err != nil && (errors.Is(a.err, context.Canceled) || r.Context().Err() == context.Canceled) {
+		if p.breaker != nil {
+			p.breaker.cancel()
+		}
+		return
+	}
+	p.health.observe(a.target, a.statusCode, a.err)
+	if p.breaker != nil {
+		p.breaker.record(!p.breaker.failure(a.statusCode, a.err))
+	}
+}
+
+// available returns the targets that may currently receive traffic, leaving
+// out those already tried for this request unless no other target is left.
+func (p *Proxy) available(tried map[*Target]bool) []*Target {
+	candidates := make([]*Target, 0, len(p.targets))
+	fresh := make([]*Target, 0, len(p.targets))
+	for _, t := range p.targets {
+		// A weight of 0 drains the target: requests in flight finish, but
+		// it is not picked for new ones.
+		if t.Weight > 0 && p.health.available(t) {
+			candidates = append(candidates, t)
+			if !tried[t] {
+				fresh = append(fresh, t)
+			}
+		}
+	}
+	if len(fresh) > 0 {
+		return fresh
+	}
+	return candidates
+}
+
+// rewriteRequestURL points req at target, the same way the director of
+// httputil.NewSingleHostReverseProxy does.
+func rewriteRequestURL(req *http.Request, target *url.URL) {
+	req.URL.Scheme = target.Scheme
+	req.URL.Host = target.Host
+	req.URL.Path, req.URL.RawPath = joinURLPath(target, req.URL)
+	if target.RawQuery == "" || req.URL.RawQuery == "" {
+		req.URL.RawQuery = target.RawQuery + req.URL.RawQuery
+	} else {
+		req.URL.RawQuery = target.RawQuery + "&" + req.URL.RawQuery
+	}
+	if _, ok := req.Header["User-Agent"]; !ok {
+		// explicitly disable User-Agent so it's not set to default value
+		req.Header.Set("User-Agent", "")
+	}
+}
+
+// joinURLPath joins the paths of a and b like singleJoiningSlash, keeping
+// their escaped forms when either has one.
+func joinURLPath(a, b *url.URL) (path, rawpath string) {
+	if a.RawPath == "" && b.RawPath == "" {
+		return singleJoiningSlash(a.Path, b.Path), ""
+	}
+	apath := a.EscapedPath()
+	bpath := b.EscapedPath()
+	aslash := strings.HasSuffix(apath, "/")
+	bslash := strings.HasPrefix(bpath, "/")
+	switch {
+	case aslash && bslash:
+		return a.Path + b.Path[1:], apath + bpath[1:]
+	case !aslash && !bslash:
+		return a.Path + "/" + b.Path, apath + "/" + bpath
+	}
+	return a.Path + b.Path, apath + bpath
+}
+
+func singleJoiningSlash(a, b string) string {
+	aslash := strings.HasSuffix(a, "/")
+	bslash := strings.HasPrefix(b, "/")
+	switch {
+	case aslash && bslash:
+		return a + b[1:]
+	case !aslash && !bslash:
+		return a + "/" + b
 	}
-	return proxy, nil
+	return a + b
 }
@@ -0,0 +1,46 @@
+package proxy
+
+import "sync"
+
+// registry holds state that must outlive a single Proxy, such as target
+// health or breaker state, so it survives router reloads. Entries are
+// reference counted and dropped once no proxy uses them.
+type registry[T any] struct {
+	mu      sync.Mutex
+	entries map[string]*registryEntry[T]
+}
+
+type registryEntry[T any] struct {
+	value T
+	refs  int
+}
+
+func newRegistry[T any]() *registry[T] {
+	return &registry[T]{entries: map[string]*registryEntry[T]{}}
+}
+
+// acquire returns the entry for key, creating it with create if needed.
+func (r *registry[T]) acquire(key string, create func() T) T {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	e, ok := r.entries[key]
+	if !ok {
+		e = &registryEntry[T]{value: create()}
+		r.entries[key] = e
+	}
+	e.refs++
+	return e.value
+}
+
+func (r *registry[T]) release(key string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if e, ok := r.entries[key]; ok {
+		e.refs--
+		if e.refs <= 0 {
+			delete(r.entries, key)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alxmorales2020/api-gateway/config"
+)
+
+const (
+	defaultRetryAttempts   = 3
+	defaultRetryBackoff    = 25 * time.Millisecond
+	defaultRetryMaxBackoff = time.Second
+	defaultRetryBudget     = 0.2
+	defaultRetryMinPerSec  = 10
+	defaultRetryMaxBody    = 1 << 20
+)
+
+var defaultRetryMethods = []string{
+	http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete,
+}
+
+// errRetryableStatus is returned from ModifyResponse to drop an upstream
+// response that is about to be retried.
+var errRetryableStatus = errors.New("retryable upstream status")
+
+// retryPolicy decides whether and when a failed attempt is retried.
+type retryPolicy struct {
+	attempts     int
+	onConnect    bool
+	onTimeout    bool
+	onError      bool
+	statuses     []int
+	methods      map[string]bool
+	backoff      time.Duration
+	maxBackoff   time.Duration
+	maxBodyBytes int64
+	budget       *retryBudget
+}
+
+func newRetryPolicy(cfg *config.RetryConfig) (*retryPolicy, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+	rp := &retryPolicy{
+		attempts:     cfg.Attempts,
+		statuses:     cfg.Statuses,
+		methods:      map[string]bool{},
+		backoff:      cfg.Backoff.Std(),
+		maxBackoff:   cfg.MaxBackoff.Std(),
+		maxBodyBytes: cfg.MaxBodyBytes,
+	}
+	if rp.attempts <= 0 {
+		rp.attempts = defaultRetryAttempts
+	}
+	if rp.backoff <= 0 {
+		rp.backoff = defaultRetryBackoff
+	}
+	if rp.maxBackoff <= 0 {
+		rp.maxBackoff = defaultRetryMaxBackoff
+	}
+	if rp.maxBodyBytes <= 0 {
+		rp.maxBodyBytes = defaultRetryMaxBody
+	}
+
+	on := cfg.On
+	if len(on) == 0 && len(cfg.Statuses) == 0 {
+		on = []string{"connect-failure", "timeout"}
+		rp.statuses = []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout}
+	}
+	for _, cond := range on {
+		switch cond {
+		case "connect-failure":
+			rp.onConnect = true
+		case "timeout":
+			rp.onTimeout = true
+		case "error":
+			rp.onError = true
+		default:
+			return nil, fmt.Errorf("retry.on: unknown condition %q (use connect-failure, timeout or error)", cond)
+		}
+	}
+
+	methods := cfg.Methods
+	if len(methods) == 0 {
+		methods = defaultRetryMethods
+	}
+	for _, m := range methods {
+		rp.methods[strings.ToUpper(m)] = true
+	}
+
+	ratio := cfg.BudgetRatio
+	if ratio <= 0 {
+		ratio = defaultRetryBudget
+	}
+	minPerSec := cfg.MinRetriesPerSecond
+	if minPerSec <= 0 {
+		minPerSec = defaultRetryMinPerSec
+	}
+	rp.budget = newRetryBudget(ratio, minPerSec)
+	return rp, nil
+}
+
+// retriesError reports whether a transport error should be retried.
+func (rp *retryPolicy) retriesError(err error) bool {
+	if rp.onError {
+		return true
+	}
+	var netErr net.Error
+	if rp.onTimeout && (errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout())) {
+		return true
+	}
+	var opErr *net.OpError
+	return rp.onConnect && errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+func (rp *retryPolicy) retriesStatus(code int) bool {
+	return containsStatus(rp.statuses, code)
+}
+
+// delay returns the exponential backoff with full jitter before retry n (1-based).
+func (rp *retryPolicy) delay(n int) time.Duration {
+	d := rp.backoff << (n - 1)
+	if d <= 0 || d > rp.maxBackoff {
+		d = rp.maxBackoff
+	}
+	return time.Duration(rand.Int63n(int64(d) + 1))
+}
+
+// replayable buffers the request body so the request can be sent more than
+// once. It returns a function producing a fresh body per attempt, or nil if the
+// request must not be retried (unsafe method, or body above the size limit).
+// In the latter case r.Body is restored so the first attempt is unaffected.
+func (rp *retryPolicy) replayable(r *http.Request) (func() io.ReadCloser, error) {
+	if !rp.methods[r.Method] {
+		return nil, nil
+	}
+	if r.Body == nil || r.Body == http.NoBody {
+		return func() io.ReadCloser { return http.NoBody }, nil
+	}
+	if r.ContentLength > rp.maxBodyBytes {
+		return nil, nil
+	}
+
+	buf, err := io.ReadAll(io.LimitReader(r.Body, rp.maxBodyBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(buf)) > rp.maxBodyBytes {
+		r.Body = readCloser{io.MultiReader(bytes.NewReader(buf), r.Body), r.Body}
+		return nil, nil
+	}
+	r.Body.Close()
+	return func() io.ReadCloser { return io.NopCloser(bytes.NewReader(buf)) }, nil
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// retryBudget caps retries at a share of the request rate, so a struggling
+// upstream does not receive a retry storm on top of its normal load. Every
+// request deposits ratio tokens, a floor of minPerSec tokens is added per
+// second, and every retry spends one token.
+type retryBudget struct {
+	mu        sync.Mutex
+	ratio     float64
+	minPerSec float64
+	tokens    float64
+	max       float64
+	last      time.Time
+}
+
+func newRetryBudget(ratio float64, minPerSec int) *retryBudget {
+	max := float64(minPerSec) * 10
+	return &retryBudget{ratio: ratio, minPerSec: float64(minPerSec), tokens: float64(minPerSec), max: max, last: time.Now()}
+}
+
+func (b *retryBudget) refill() {
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.minPerSec
+	b.last = now
+	if b.tokens > b.max {
+		b.tokens = b.max
+	}
+}
+
+func (b *retryBudget) deposit() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill()
+	b.tokens += b.ratio
+	if b.tokens > b.max {
+		b.tokens = b.max
+	}
+}
+
+func (b *retryBudget) take() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill()
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
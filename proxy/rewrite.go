@@ -0,0 +1,123 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/alxmorales2020/api-gateway/config"
+	"github.com/alxmorales2020/api-gateway/core"
+)
+
+// placeholderPattern finds the {name} placeholders of a rewrite template.
+var placeholderPattern = regexp.MustCompile(`\{([^{}]+)\}`)
+
+// rewriter turns the path of a request into the path sent upstream, before
+// it is joined with the target's path.
+type rewriter struct {
+	stripPrefix string
+	path        string // template, may carry a query
+	rules       []rewriteRule
+	basePath    string
+}
+
+type rewriteRule struct {
+	match   *regexp.Regexp
+	replace string
+}
+
+func newRewriter(cfg *config.RewriteConfig, stripPrefix string) (*rewriter, error) {
+	rw := &rewriter{stripPrefix: stripPrefix}
+	if cfg == nil {
+		return rw, nil
+	}
+	rw.path = cfg.Path
+	rw.basePath = cfg.BasePath
+	for i, rule := range cfg.Regex {
+		re, err := regexp.Compile(rule.Match)
+		if err != nil {
+			return nil, fmt.Errorf("rewrite.regex[%d]: %v", i, err)
+		}
+		rw.rules = append(rw.rules, rewriteRule{match: re, replace: rule.Replace})
+	}
+	return rw, nil
+}
+
+// apply rewrites req's path in place: strip_prefix first, then the path
+// template, the regex rules in order and finally the base path. It works on
+// the escaped path, so an encoded "/" in a parameter stays part of one
+// segment.
+func (rw *rewriter) apply(req *http.Request) {
+	original := req.URL.EscapedPath()
+	path := original
+	if rw.stripPrefix != "" && strings.HasPrefix(path, rw.stripPrefix) {
+		path = strings.TrimPrefix(path, rw.stripPrefix)
+	}
+
+	if rw.path != "" {
+		var params map[string]string
+		if rc := core.GetRequestContext(req); rc != nil {
+			params = rc.Params
+		}
+		template, query, hasQuery := strings.Cut(rw.path, "?")
+		path = expand(template, params, escapeSegment)
+		if hasQuery {
+			query = expand(query, params, url.QueryEscape)
+			if req.URL.RawQuery != "" {
+				query += "&" + req.URL.RawQuery
+			}
+			req.URL.RawQuery = query
+		}
+	}
+
+	for _, rule := range rw.rules {
+		path = rule.match.ReplaceAllString(path, rule.replace)
+	}
+	if rw.basePath != "" {
+		path = singleJoiningSlash(rw.basePath, path)
+	}
+	if path == "" {
+		path = "/"
+	}
+
+	if path != original {
+		unescaped, err := url.PathUnescape(path)
+		if err != nil {
+			unescaped = path
+		}
+		req.URL.Path = unescaped
+		req.URL.RawPath = ""
+		if unescaped != path {
+			req.URL.RawPath = path
+		}
+	}
+}
+
+// escapeSegment escapes a parameter value as a single path segment: "/",
+// "?" and the like are percent-encoded, and so are the dot segments "." and
+// "..", which would otherwise climb out of the templated path.
+func escapeSegment(value string) string {
+	if value == "." || value == ".." {
+		return strings.Repeat("%2E", len(value))
+	}
+	return url.PathEscape(value)
+}
+
+// expand replaces the {name} placeholders of template with the parameter
+// values, escaped by escape. Unknown parameters expand to nothing.
+func expand(template string, params map[string]string, escape func(string) string) string {
+	return placeholderPattern.ReplaceAllStringFunc(template, func(placeholder string) string {
+		return escape(params[placeholder[1:len(placeholder)-1]])
+	})
+}
+
+// Placeholders returns the parameter names used by a rewrite template.
+func Placeholders(template string) []string {
+	var names []string
+	for _, m := range placeholderPattern.FindAllStringSubmatch(template, -1) {
+		names = append(names, m[1])
+	}
+	return names
+}
@@ -0,0 +1,106 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/alxmorales2020/api-gateway/config"
+)
+
+// newTransport returns the transport for a route, applying its connection
+// timeouts on top of http.DefaultTransport's settings.
+func newTransport(cfg *config.TimeoutConfig) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg == nil {
+		return transport
+	}
+
+	if cfg.Connect > 0 {
+		dialer := &net.Dialer{Timeout: cfg.Connect.Std(), KeepAlive: 30 * time.Second}
+		transport.DialContext = dialer.DialContext
+	}
+	if cfg.TLSHandshake > 0 {
+		transport.TLSHandshakeTimeout = cfg.TLSHandshake.Std()
+	}
+	if cfg.ResponseHeader > 0 {
+		transport.ResponseHeaderTimeout = cfg.ResponseHeader.Std()
+	}
+	if cfg.Idle > 0 {
+		transport.IdleConnTimeout = cfg.Idle.Std()
+	}
+	return transport
+}
+
+// Phases of an upstream attempt, recorded by its client trace. The transport
+// reports its TLS handshake and response header timeouts with unexported
+// error types, so the phase tells which of its timers fired.
+const (
+	phaseConnect int32 = iota
+	phaseTLSHandshake
+	phaseAwaitHeaders
+	phaseResponse
+)
+
+// trace returns the client trace recording the attempt's phase.
+func (a *attempt) trace() *httptrace.ClientTrace {
+	set := func(phase int32) { atomic.StoreInt32(&a.phase, phase) }
+	return &httptrace.ClientTrace{
+		TLSHandshakeStart: func() { set(phaseTLSHandshake) },
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			if err == nil {
+				set(phaseConnect)
+			}
+		},
+		WroteRequest:         func(httptrace.WroteRequestInfo) { set(phaseAwaitHeaders) },
+		GotFirstResponseByte: func() { set(phaseResponse) },
+	}
+}
+
+// timeoutKind names the timeout behind err, or returns "" if err is not a
+// timeout. r is the request that failed; its context carries the route's
+// request deadline and, for upstream requests, the attempt and its phase.
+func timeoutKind(r *http.Request, err error) string {
+	if errors.Is(r.Context().Err(), context.DeadlineExceeded) {
+		return "request deadline exceeded"
+	}
+	var netErr net.Error
+	if !errors.Is(err, context.DeadlineExceeded) && !(errors.As(err, &netErr) && netErr.Timeout()) {
+		return ""
+	}
+
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return "connect timeout"
+	}
+	if a := attemptFrom(r); a != nil {
+		switch atomic.LoadInt32(&a.phase) {
+		case phaseTLSHandshake:
+			return "TLS handshake timeout"
+		case phaseAwaitHeaders:
+			return "response header timeout"
+		}
+	}
+
+	// Last resort for errors the phase does not explain, e.g. a transport
+	// that does not run the trace hooks.
+	switch msg := err.Error(); {
+	case strings.Contains(msg, "timeout awaiting response headers"):
+		return "response header timeout"
+	case strings.Contains(msg, "TLS handshake timeout"):
+		return "TLS handshake timeout"
+	}
+	return "timeout"
+}
+
+// writeTimeout answers a request whose upstream timed out.
+func writeTimeout(w http.ResponseWriter, kind string) {
+	w.Header().Set("X-Gateway-Error", "upstream-timeout")
+	http.Error(w, "Upstream timeout: "+kind, http.StatusGatewayTimeout)
+}
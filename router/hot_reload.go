@@ -1,24 +1,53 @@
 package router
 
 import (
+	"fmt"
 	"log"
 	"net/http"
 	"strings"
+	"sync"
 	"sync/atomic"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 
 	"github.com/alxmorales2020/api-gateway/config"
+	"github.com/alxmorales2020/api-gateway/proxy"
 )
 
 type Reloader interface {
 	Reload() error
 }
 
+// Runtime is the view of the serving router used by the admin API.
+type Runtime interface {
+	Reloader
+	ReloadRoutes(routes []config.RouteConfig, commit func() error) error
+	DryRun() (*ReloadCheck, error)
+	Upstreams() []UpstreamStatus
+}
+
+// ReloadCheck is the outcome of building a router from the stored routes
+// without swapping it in.
+type ReloadCheck struct {
+	Serving   []config.RouteConfig // routes currently serving
+	Candidate []config.RouteConfig // routes a reload would serve
+	Err       error                // why the candidate failed to build, nil if a reload would succeed
+}
+
+// UpstreamStatus describes the upstream targets of one serving route.
+type UpstreamStatus struct {
+	RouteID        string               `json:"route_id,omitempty"`
+	Path           string               `json:"path"`
+	Balancer       string               `json:"balancer"`
+	Targets        []proxy.TargetStatus `json:"targets"`
+	CircuitBreaker *proxy.BreakerStatus `json:"circuit_breaker,omitempty"`
+}
+
 type Manager struct {
 	store   config.RouteStore
-	current atomic.Value // holds http.Handler
+	mu      sync.Mutex   // serializes reloads
+	current atomic.Value // holds *appRouter
 }
 
 func NewManager(store config.RouteStore) (*Manager, error) {
@@ -32,53 +61,187 @@ func NewManager(store config.RouteStore) (*Manager, error) {
 // ServeHTTP lets Manager be used as an http.Handler.
 // It delegates to the current router atomically.
 func (m *Manager) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	h, _ := m.current.Load().(http.Handler)
-	h.ServeHTTP(w, r)
+	app, _ := m.current.Load().(*appRouter)
+	app.ServeHTTP(w, r)
 }
 
 func (m *Manager) Reload() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	routes, err := m.store.LoadRoutes()
 	if err != nil {
 		return err
 	}
-	app := buildAppRouter(routes)
+	return m.swap(routes, nil)
+}
+
+// DryRun builds a router from the stored routes and discards it, reporting
+// what a reload would serve and whether it would succeed. The serving router
+// is left alone: the candidate's proxies are detached, so no health checks
+// run and no health or breaker state is shared with the serving proxies. The
+// error is only set if the routes cannot be loaded.
+func (m *Manager) DryRun() (*ReloadCheck, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	routes, err := m.store.LoadRoutes()
+	if err != nil {
+		return nil, err
+	}
+	check := &ReloadCheck{Candidate: routes}
+	if current, _ := m.current.Load().(*appRouter); current != nil {
+		check.Serving = current.routes
+	}
+	app, err := buildAppRouter(routes, proxy.NewDetachedProxy)
+	if err != nil {
+		check.Err = err
+		return check, nil
+	}
+	app.Close()
+	return check, nil
+}
+
+// ReloadRoutes builds a router from routes that are not in the store yet. Only
+// if that succeeds is commit called to store them and the new router swapped
+// in; otherwise the current routes keep serving. In-flight requests finish on
+// the router that accepted them.
+func (m *Manager) ReloadRoutes(routes []config.RouteConfig, commit func() error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.swap(routes, commit)
+}
+
+func (m *Manager) swap(routes []config.RouteConfig, commit func() error) error {
+	app, err := buildAppRouter(routes, proxy.NewReverseProxy)
+	if err != nil {
+		return err
+	}
+	if commit != nil {
+		if err := commit(); err != nil {
+			app.Close()
+			return err
+		}
+	}
+	previous, _ := m.current.Load().(*appRouter)
 	m.current.Store(app)
+	if previous != nil {
+		previous.Close()
+	}
 	log.Printf("Router reloaded with %d route(s).", len(routes))
 	return nil
 }
 
-// buildAppRouter is your existing NewRouter but returning a chi.Router
-// for the app routes only (no /admin here).
-func buildAppRouter(routes []config.RouteConfig) http.Handler {
+// Upstreams reports the upstream targets of the routes currently serving.
+func (m *Manager) Upstreams() []UpstreamStatus {
+	app, _ := m.current.Load().(*appRouter)
+	out := make([]UpstreamStatus, 0, len(app.upstreams))
+	for _, u := range app.upstreams {
+		balancer := "round-robin"
+		if u.route.Pool != nil && u.route.Pool.Balancer != "" {
+			balancer = u.route.Pool.Balancer
+		}
+		out = append(out, UpstreamStatus{
+			RouteID:        u.route.ID,
+			Path:           u.route.Path,
+			Balancer:       balancer,
+			Targets:        u.proxy.Status(),
+			CircuitBreaker: u.proxy.BreakerStatus(),
+		})
+	}
+	return out
+}
+
+// routePattern returns the chi pattern a route is registered on: its path
+// without the trailing "*" of a prefix route or trailing slashes, which the
+// router strips from requests.
+func routePattern(path string) string {
+	pattern := strings.TrimRight(strings.TrimSuffix(path, "*"), "/")
+	if pattern == "" {
+		return "/"
+	}
+	return pattern
+}
+
+// appRouter is a built set of app routes and the proxies behind them.
+type appRouter struct {
+	http.Handler
+	routes    []config.RouteConfig
+	upstreams []routeUpstream
+}
+
+type routeUpstream struct {
+	route config.RouteConfig
+	proxy *proxy.Proxy
+}
+
+// Close releases the proxies of a router that no longer serves traffic.
+func (a *appRouter) Close() {
+	for _, u := range a.upstreams {
+		u.proxy.Close()
+	}
+}
+
+// buildAppRouter builds the router for the app routes only (no /admin here),
+// taking each route's proxy from newProxy. It fails the whole build when any
+// route does not pass ValidateRoutes, so a reload never silently drops or
+// breaks a route. The plugins initialized by the validation are the ones
+// that serve, so each is initialized once per build. A panic from chi on a
+// route that slipped past validation fails the build the same way.
+func buildAppRouter(routes []config.RouteConfig, newProxy proxyBuilder) (app *appRouter, err error) {
+	plugins, err := validateRoutes(routes)
+	if err != nil {
+		return nil, err
+	}
+
 	r := chi.NewRouter()
 	r.Use(middleware.StripSlashes)
+	app = &appRouter{Handler: r, routes: routes}
+	defer func() {
+		if p := recover(); p != nil {
+			app.Close()
+			app, err = nil, fmt.Errorf("building router: %v", p)
+		}
+	}()
 
-	for _, route := range routes {
+	// Exact routes on the same path share one chi pattern and are told apart
+	// by their methods and match conditions. Prefix routes are matched by
+	// the prefix table, which also serves whatever chi does not match.
+	prefixes := &prefixTable{}
+	groups := map[string]*routeGroup{}
+	for i, route := range routes {
 		isPrefix := strings.HasSuffix(route.Path, "*")
 		cleanPath := strings.TrimSuffix(route.Path, "*")
-		handler := generateHandler(route, cleanPath, isPrefix)
-		if handler == nil || len(route.Methods) == 0 {
-			continue
+		match, err := compileMatch(route.Match)
+		if err != nil {
+			app.Close()
+			return nil, fmt.Errorf("route %s: %w", route.Path, err)
+		}
+		handler, routeProxy := generateHandler(route, plugins[i], cleanPath, isPrefix, newProxy)
+		if routeProxy != nil {
+			app.upstreams = append(app.upstreams, routeUpstream{route: route, proxy: routeProxy})
 		}
 
 		if isPrefix {
-			sub := chi.NewRouter()
-			sub.Handle("/*", handler) // any method
-			r.Mount(cleanPath, sub)
-		} else {
-			for _, method := range route.Methods {
-				r.Method(method, route.Path, handler)
-			}
+			prefixes.add(route, match, handler)
+			continue
+		}
+		pattern := routePattern(route.Path)
+		key := paramShape(pattern)
+		group, ok := groups[key]
+		if !ok {
+			group = &routeGroup{prefixes: prefixes}
+			groups[key] = group
+			r.Handle(pattern, group)
 		}
+		group.routes = append(group.routes, newCandidate(route, match, handler))
 	}
 
 	// health
 	r.Get("/ping", func(w http.ResponseWriter, r *http.Request) { _, _ = w.Write([]byte("pong")) })
 
-	// 404
-	r.NotFound(func(w http.ResponseWriter, r *http.Request) {
-		http.Error(w, "Route not found", http.StatusNotFound)
-	})
+	// Prefix routes, 405 and 404
+	r.NotFound(prefixes.ServeHTTP)
 
-	return r
+	return app, nil
 }
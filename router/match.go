@@ -0,0 +1,281 @@
+package router
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/alxmorales2020/api-gateway/config"
+	"github.com/go-chi/chi/v5"
+)
+
+// matcher holds the compiled host, header and query conditions of a route.
+type matcher struct {
+	hosts   []string // lower case; "*.example.com" matches any subdomain
+	headers []valueMatcher
+	query   []valueMatcher
+}
+
+type valueMatcher struct {
+	name  string
+	value string
+	regex *regexp.Regexp // nil unless the matcher has a regex
+	exact bool           // compare against value
+}
+
+// rank orders the routes matching a request, most specific first: an exact
+// host beats a wildcard host, which beats no host condition; longer wildcards
+// beat shorter ones; then more header and query conditions win.
+type rank struct {
+	host       int // 2 exact, 1 wildcard, 0 none
+	hostLength int // length of the matching wildcard
+	conditions int // header and query conditions
+}
+
+func (r rank) better(other rank) bool {
+	if r.host != other.host {
+		return r.host > other.host
+	}
+	if r.hostLength != other.hostLength {
+		return r.hostLength > other.hostLength
+	}
+	return r.conditions > other.conditions
+}
+
+// compileMatch compiles a route's match config. A nil config gives a nil
+// matcher, which matches every request.
+func compileMatch(cfg *config.MatchConfig) (*matcher, error) {
+	if cfg == nil || len(cfg.Hosts)+len(cfg.Headers)+len(cfg.Query) == 0 {
+		return nil, nil
+	}
+	m := &matcher{}
+	for _, host := range cfg.Hosts {
+		m.hosts = append(m.hosts, strings.ToLower(host))
+	}
+	var err error
+	if m.headers, err = compileValues("headers", cfg.Headers, http.CanonicalHeaderKey); err != nil {
+		return nil, err
+	}
+	if m.query, err = compileValues("query", cfg.Query, func(name string) string { return name }); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func compileValues(kind string, cfgs []config.ValueMatcher, canonical func(string) string) ([]valueMatcher, error) {
+	out := make([]valueMatcher, 0, len(cfgs))
+	for i, c := range cfgs {
+		vm := valueMatcher{name: canonical(c.Name), value: c.Value, exact: c.Value != ""}
+		if c.Regex != "" {
+			re, err := regexp.Compile("^(?:" + c.Regex + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("match.%s[%d].regex: %v", kind, i, err)
+			}
+			vm.regex = re
+		}
+		out = append(out, vm)
+	}
+	return out, nil
+}
+
+// match reports whether the request meets every condition, and how
+// specifically.
+func (m *matcher) match(r *http.Request) (rank, bool) {
+	if m == nil {
+		return rank{}, true
+	}
+	rk := rank{conditions: len(m.headers) + len(m.query)}
+	if len(m.hosts) > 0 {
+		host := requestHost(r)
+		matched := false
+		for _, pattern := range m.hosts {
+			switch {
+			case pattern == host:
+				rk.host, rk.hostLength, matched = 2, 0, true
+			case strings.HasPrefix(pattern, "*.") && strings.HasSuffix(host, pattern[1:]) && len(host) > len(pattern)-1:
+				if rk.host < 2 && len(pattern) > rk.hostLength {
+					rk.host, rk.hostLength, matched = 1, len(pattern), true
+				}
+			}
+		}
+		if !matched {
+			return rank{}, false
+		}
+	}
+	for _, vm := range m.headers {
+		if !vm.matchAny(r.Header.Values(vm.name)) {
+			return rank{}, false
+		}
+	}
+	if len(m.query) > 0 {
+		query := r.URL.Query()
+		for _, vm := range m.query {
+			if !vm.matchAny(query[vm.name]) {
+				return rank{}, false
+			}
+		}
+	}
+	return rk, true
+}
+
+func (vm *valueMatcher) matchAny(values []string) bool {
+	for _, v := range values {
+		if (!vm.exact || v == vm.value) && (vm.regex == nil || vm.regex.MatchString(v)) {
+			return true
+		}
+	}
+	return false
+}
+
+// requestHost returns the request's host name in lower case, without port.
+func requestHost(r *http.Request) string {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(strings.TrimSuffix(host, "."))
+}
+
+// candidate is a route as seen by routeGroup and prefixTable.
+type candidate struct {
+	priority  int
+	prefixLen int             // length of a prefix route's prefix, 0 for exact routes
+	methods   map[string]bool // upper case
+	match     *matcher
+	handler   http.Handler
+	mux       *chi.Mux // prefix routes only: matches the path and serves the route
+}
+
+func newCandidate(route config.RouteConfig, match *matcher, handler http.Handler) candidate {
+	c := candidate{priority: route.Priority, match: match, handler: handler, methods: map[string]bool{}}
+	for _, method := range route.Methods {
+		c.methods[strings.ToUpper(method)] = true
+	}
+	return c
+}
+
+// better orders candidates: higher priority first, then longer prefixes,
+// then more specific match conditions.
+func (c *candidate) better(rk rank, other *candidate, otherRank rank) bool {
+	if c.priority != other.priority {
+		return c.priority > other.priority
+	}
+	if c.prefixLen != other.prefixLen {
+		return c.prefixLen > other.prefixLen
+	}
+	return rk.better(otherRank)
+}
+
+// pick returns the best candidate that takes the request, the first
+// configured on a tie. Methods of candidates that match but do not take the
+// request's method are added to allowed. matchPath filters candidates by path
+// first if set.
+func pick(candidates []candidate, r *http.Request, matchPath func(*candidate) bool, allowed map[string]bool) *candidate {
+	var best *candidate
+	var bestRank rank
+	for i := range candidates {
+		c := &candidates[i]
+		if matchPath != nil && !matchPath(c) {
+			continue
+		}
+		rk, ok := c.match.match(r)
+		if !ok {
+			continue
+		}
+		if !c.methods[r.Method] {
+			for method := range c.methods {
+				allowed[method] = true
+			}
+			continue
+		}
+		if best == nil || c.better(rk, best, bestRank) {
+			best, bestRank = c, rk
+		}
+	}
+	return best
+}
+
+// routeGroup serves the exact routes registered on one chi pattern. chi
+// matches the path; the group then picks among the routes whose conditions
+// hold and that take the method. If none does, the prefix routes get a go.
+type routeGroup struct {
+	routes   []candidate
+	prefixes *prefixTable
+}
+
+func (g *routeGroup) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	allowed := map[string]bool{}
+	if best := pick(g.routes, r, nil, allowed); best != nil {
+		best.handler.ServeHTTP(w, r)
+		return
+	}
+	// The prefix routes must not see the exact pattern's parameters.
+	if rctx := chi.RouteContext(r.Context()); rctx != nil {
+		rctx.URLParams = chi.RouteParams{}
+	}
+	g.prefixes.serve(w, r, allowed)
+}
+
+// prefixTable serves the prefix routes. All routes whose prefix covers the
+// request path are considered, so overlapping prefixes such as /api* and
+// /api/v2* coexist: the higher priority wins, then the longer prefix.
+type prefixTable struct {
+	routes []candidate
+}
+
+func (t *prefixTable) add(route config.RouteConfig, match *matcher, handler http.Handler) {
+	pattern := routePattern(route.Path)
+	c := newCandidate(route, match, handler)
+	c.prefixLen = len(paramShape(pattern))
+	c.mux = chi.NewRouter()
+	sub := chi.NewRouter()
+	sub.Handle("/*", handler)
+	c.mux.Mount(pattern, sub)
+	t.routes = append(t.routes, c)
+}
+
+func (t *prefixTable) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	t.serve(w, r, map[string]bool{})
+}
+
+// serve answers with the best prefix route, or with 405 if routes on the
+// path exist but none takes the method, or 404.
+func (t *prefixTable) serve(w http.ResponseWriter, r *http.Request, allowed map[string]bool) {
+	path := routePath(r)
+	best := pick(t.routes, r, func(c *candidate) bool {
+		return c.mux.Match(chi.NewRouteContext(), http.MethodGet, path)
+	}, allowed)
+
+	switch {
+	case best != nil:
+		// The route's own mux fills in the path parameters of its prefix.
+		best.mux.ServeHTTP(w, r)
+	case len(allowed) > 0:
+		methods := make([]string, 0, len(allowed))
+		for method := range allowed {
+			methods = append(methods, method)
+		}
+		sort.Strings(methods)
+		w.Header().Set("Allow", strings.Join(methods, ", "))
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	default:
+		http.Error(w, "Route not found", http.StatusNotFound)
+	}
+}
+
+// routePath returns the path chi routes the request on.
+func routePath(r *http.Request) string {
+	if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePath != "" {
+		return rctx.RoutePath
+	}
+	if r.URL.RawPath != "" {
+		return r.URL.RawPath
+	}
+	if r.URL.Path == "" {
+		return "/"
+	}
+	return r.URL.Path
+}
@@ -3,91 +3,66 @@ package router
 import (
 	"log"
 	"net/http"
+	"net/url"
 	"strings"
 
 	"github.com/alxmorales2020/api-gateway/config"
 	"github.com/alxmorales2020/api-gateway/core"
 	"github.com/alxmorales2020/api-gateway/proxy"
 	"github.com/go-chi/chi/v5"
-	"github.com/go-chi/chi/v5/middleware"
 )
 
-// NewRouter initializes a new Chi router with the provided gateway configuration.
-func NewRouter(routes []config.RouteConfig) http.Handler {
-	router := chi.NewRouter()
-	router.Use(middleware.StripSlashes)
+// proxyBuilder builds the proxy for a route, see proxy.NewReverseProxy.
+type proxyBuilder func(route config.RouteConfig, stripPrefix string) (*proxy.Proxy, error)
 
-	// Register routes based on the configuration
-	for _, route := range routes {
-		log.Printf("Registering route %s %v → %s", route.Path, route.Methods, route.Upstream)
-
-		isPrefix := strings.HasSuffix(route.Path, "*")
-		cleanPath := strings.TrimSuffix(route.Path, "*")
-		handler := generateHandler(route, cleanPath, isPrefix)
-		if handler == nil {
-			log.Printf("No methods defined for path %s — skipping", route.Path)
-			continue
-		}
-
-		if isPrefix {
-			subRouter := chi.NewRouter()
-			subRouter.Handle("/*", handler)
-			router.Mount(cleanPath, subRouter)
-			log.Printf("Mounted path prefix route: %s* → %s", cleanPath, route.Upstream)
-		} else {
-			for _, method := range route.Methods {
-				router.Method(method, route.Path, handler)
-				log.Printf("Bound %s %s → %s", method, route.Path, route.Upstream)
-			}
-		}
-	}
-
-	// Add a default route for health checks
-	router.Get("/ping", func(writer http.ResponseWriter, request *http.Request) {
-		writer.Write([]byte("pong"))
-	})
-
-	router.NotFound(func(w http.ResponseWriter, r *http.Request) {
-		log.Printf("ROUTE NOT FOUND: %s %s", r.Method, r.URL.Path)
-		http.Error(w, "Route not found", http.StatusNotFound)
-	})
-
-	log.Println("Gateway router initialized.")
-	return router
-}
-
-// generateHandler creates an HTTP handler for a given route configuration.
-func generateHandler(route config.RouteConfig, prefix string, strip bool) http.HandlerFunc {
-	plugins := []core.Plugin{}
-	for _, name := range route.Plugins {
-		plugin := core.GetPlugin(name)
-		if plugin == nil {
-			log.Printf("Plugin not found: %s", name)
-			continue
-		}
-		_ = plugin.Init(nil)
-		plugins = append(plugins, plugin)
-	}
-
-	proxyHandler, err := proxy.NewReverseProxy(route.Upstream, prefixIf(strip, prefix))
+// generateHandler creates an HTTP handler for a given route configuration
+// and its initialized plugins, along with the proxy newProxy built for it
+// (nil if the upstream config is broken).
+func generateHandler(route config.RouteConfig, plugins []core.Plugin, prefix string, strip bool, newProxy proxyBuilder) (http.HandlerFunc, *proxy.Proxy) {
+	proxyHandler, err := newProxy(route, prefixIf(strip, prefix))
 	if err != nil {
 		log.Printf("Proxy error for %s: %v", route.Path, err)
 		return func(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "Bad gateway config", http.StatusBadGateway)
-		}
+		}, nil
 	}
 
+	pipeline := core.NewPipeline(core.RouteInfo{ID: route.ID, Path: route.Path}, plugins)
 	return func(writer http.ResponseWriter, request *http.Request) {
-		recorder := core.NewResponseRecorder(writer)
+		pipeline.Serve(writer, request, urlParams(request), proxyHandler)
+	}, proxyHandler
+}
 
-		for _, plugin := range plugins {
-			if err := plugin.Execute(recorder, request); err != nil {
-				return
+// urlParams collects the chi path parameters matched for the request,
+// decoded. chi takes them from the escaped path when the request was routed
+// on it, and only then are they unescaped: a value from the decoded path is
+// already final, and a literal "%41" in it must stay "%41".
+func urlParams(request *http.Request) map[string]string {
+	params := map[string]string{}
+	escaped := routedOnRawPath(request)
+	if rctx := chi.RouteContext(request.Context()); rctx != nil {
+		for i, key := range rctx.URLParams.Keys {
+			if key == "*" {
+				continue
+			}
+			value := rctx.URLParams.Values[i]
+			if escaped {
+				if unescaped, err := url.PathUnescape(value); err == nil {
+					value = unescaped
+				}
 			}
+			params[key] = value
 		}
-
-		proxyHandler.ServeHTTP(recorder, request)
 	}
+	return params
+}
+
+// routedOnRawPath reports whether chi routed the request on URL.RawPath. It
+// does whenever RawPath is set, unless StripSlashes replaced the routing path
+// with the decoded URL.Path less its trailing slash.
+func routedOnRawPath(request *http.Request) bool {
+	path := request.URL.Path
+	return request.URL.RawPath != "" && !(len(path) > 1 && strings.HasSuffix(path, "/"))
 }
 
 func prefixIf(condition bool, prefix string) string {
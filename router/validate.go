@@ -0,0 +1,451 @@
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/alxmorales2020/api-gateway/config"
+	"github.com/alxmorales2020/api-gateway/core"
+	"github.com/alxmorales2020/api-gateway/proxy"
+)
+
+// FieldError is one problem with a route definition. Field is the dotted
+// JSON path of the offending field, e.g. "plugins[1].config".
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists everything wrong with a set of route definitions.
+type ValidationError struct {
+	Errors []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, fe := range e.Errors {
+		msgs[i] = fe.Field + ": " + fe.Message
+	}
+	return "invalid routes: " + strings.Join(msgs, "; ")
+}
+
+// methods are the HTTP methods chi can route.
+var methods = map[string]bool{
+	"CONNECT": true, "DELETE": true, "GET": true, "HEAD": true, "OPTIONS": true,
+	"PATCH": true, "POST": true, "PUT": true, "TRACE": true,
+}
+
+// ValidateRoutes checks every route with ValidateRoute and that no two routes
+// claim the same path and method. It returns a *ValidationError with fields
+// prefixed by "routes[i].", or nil if the routes can go live.
+func ValidateRoutes(routes []config.RouteConfig) error {
+	_, err := validateRoutes(routes)
+	return err
+}
+
+// validateRoutes is ValidateRoutes, also returning the plugins of each route
+// as initialized by the check.
+func validateRoutes(routes []config.RouteConfig) ([][]core.Plugin, error) {
+	var errs []FieldError
+	plugins := make([][]core.Plugin, len(routes))
+	for i, route := range routes {
+		prefix := fmt.Sprintf("routes[%d].", i)
+		fields, initialized := validateRoute(route)
+		plugins[i] = initialized
+		fields = append(fields, RouteConflicts(route, routes[:i])...)
+		for _, fe := range fields {
+			errs = append(errs, FieldError{Field: prefix + fe.Field, Message: fe.Message})
+		}
+	}
+	if len(errs) > 0 {
+		return nil, &ValidationError{Errors: errs}
+	}
+	return plugins, nil
+}
+
+// ValidateRoute checks a single route definition: its path, methods and
+// upstream URLs, and that its plugins exist and accept their config.
+func ValidateRoute(route config.RouteConfig) []FieldError {
+	errs, _ := validateRoute(route)
+	return errs
+}
+
+// validateRoute is ValidateRoute, also returning the route's plugins, each
+// initialized with its config, in order.
+func validateRoute(route config.RouteConfig) ([]FieldError, []core.Plugin) {
+	var errs []FieldError
+	add := func(field, format string, args ...interface{}) {
+		errs = append(errs, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if msg := checkPath(route.Path); msg != "" {
+		add("path", "%s", msg)
+	}
+
+	if len(route.Methods) == 0 {
+		add("methods", "at least one method is required")
+	}
+	seen := map[string]bool{}
+	for i, method := range route.Methods {
+		upper := strings.ToUpper(method)
+		switch {
+		case !methods[upper]:
+			add(fmt.Sprintf("methods[%d]", i), "unknown HTTP method %q", method)
+		case seen[upper]:
+			add(fmt.Sprintf("methods[%d]", i), "%s is listed twice", upper)
+		}
+		seen[upper] = true
+	}
+
+	switch {
+	case route.Pool != nil:
+		if len(route.Pool.Targets) == 0 {
+			add("upstream_pool.targets", "at least one target is required")
+		}
+		serving := false
+		for i, target := range route.Pool.Targets {
+			if msg := checkUpstream(target.URL); msg != "" {
+				add(fmt.Sprintf("upstream_pool.targets[%d].url", i), "%s", msg)
+			}
+			switch weight := target.EffectiveWeight(); {
+			case weight < 0:
+				add(fmt.Sprintf("upstream_pool.targets[%d].weight", i), "must not be negative")
+			case weight > 0:
+				serving = true
+			}
+		}
+		if len(route.Pool.Targets) > 0 && !serving {
+			add("upstream_pool.targets", "at least one target needs a weight above 0")
+		}
+	case route.Upstream == "":
+		add("upstream", "an upstream or upstream_pool is required")
+	default:
+		if msg := checkUpstream(route.Upstream); msg != "" {
+			add("upstream", "%s", msg)
+		}
+	}
+
+	if route.Match != nil {
+		errs = append(errs, checkMatch(route.Match)...)
+	}
+	if route.Rewrite != nil {
+		errs = append(errs, checkRewrite(route.Path, route.Rewrite)...)
+	}
+
+	plugins := make([]core.Plugin, 0, len(route.Plugins))
+	for i, entry := range route.Plugins {
+		plugin := core.GetPlugin(entry.Name)
+		if plugin == nil {
+			add(fmt.Sprintf("plugins[%d].name", i), "unknown plugin %q", entry.Name)
+			continue
+		}
+		if err := plugin.Init(entry.Config); err != nil {
+			add(fmt.Sprintf("plugins[%d].config", i), "%v", err)
+			continue
+		}
+		plugins = append(plugins, plugin)
+	}
+	errs = append(errs, checkPluginOrder(route.Plugins)...)
+	return errs, plugins
+}
+
+// mustPrecede lists, by plugin, the plugins that have to come before it on a
+// route. A cache hit is answered in the access phase: the plugins after
+// cache never see the request, and no upstream response phase runs, so auth
+// would be skipped and response transforms would only apply to misses.
+var mustPrecede = map[string][]string{
+	"cache": {"jwt-auth", "header-transform", "body-transform"},
+}
+
+// checkPluginOrder reports plugins listed after a plugin they must precede.
+func checkPluginOrder(entries []config.PluginConfig) []FieldError {
+	var errs []FieldError
+	for i, entry := range entries {
+		for _, before := range mustPrecede[entry.Name] {
+			for j := i + 1; j < len(entries); j++ {
+				if entries[j].Name == before {
+					errs = append(errs, FieldError{
+						Field:   fmt.Sprintf("plugins[%d].name", j),
+						Message: fmt.Sprintf("%s must be listed before %s", before, entry.Name),
+					})
+				}
+			}
+		}
+	}
+	return errs
+}
+
+// RouteConflicts reports where route claims a path and method that one of
+// others already serves under the same match conditions, or shares a path
+// with another route but names its parameters differently. Routes with the
+// same ID as route are skipped, so a route can be checked against the stored
+// version of itself.
+func RouteConflicts(route config.RouteConfig, others []config.RouteConfig) []FieldError {
+	var errs []FieldError
+	conflict := func(other config.RouteConfig, format string, args ...interface{}) {
+		name := other.Path
+		if other.ID != "" {
+			name = fmt.Sprintf("%s (%s)", other.ID, other.Path)
+		}
+		errs = append(errs, FieldError{Field: "path", Message: fmt.Sprintf(format, args...) + " route " + name})
+	}
+
+	shape, pattern := pathShape(route.Path)
+	keys := routeKeys(route)
+	for _, other := range others {
+		if route.ID != "" && other.ID == route.ID {
+			continue
+		}
+		otherShape, otherPattern := pathShape(other.Path)
+		if otherShape != shape {
+			continue
+		}
+		// Exact routes of the same shape share a chi pattern; prefix routes
+		// are matched one by one and may name their parameters freely.
+		if otherPattern != pattern && !strings.HasPrefix(shape, "prefix ") {
+			conflict(other, "parameter names differ from")
+			continue
+		}
+		for key := range routeKeys(other) {
+			if claim, ok := keys[key]; ok {
+				conflict(other, "%s conflicts with", claim)
+				break
+			}
+		}
+	}
+	return errs
+}
+
+// pathShape returns the chi pattern of a route and its shape: whether it is a
+// prefix route and the pattern with parameter names left out. Exact routes of
+// the same shape share a chi pattern.
+func pathShape(path string) (shape, pattern string) {
+	pattern = routePattern(path)
+	shape = paramShape(pattern)
+	if strings.HasSuffix(path, "*") {
+		shape = "prefix " + shape
+	}
+	return shape, pattern
+}
+
+// routeKeys returns what a route claims within its shape: each of its
+// methods under its match conditions. The values describe the claims for
+// error messages. Priorities do not settle a conflict, since the route with
+// the lower one could never be reached.
+func routeKeys(route config.RouteConfig) map[string]string {
+	conditions := matchSignature(route.Match)
+	keys := map[string]string{}
+	for _, method := range route.Methods {
+		method = strings.ToUpper(method)
+		keys[method+conditions] = method + " " + route.Path + conditions
+	}
+	return keys
+}
+
+// matchSignature renders match conditions canonically, so routes with the
+// same conditions in a different order compare equal.
+func matchSignature(cfg *config.MatchConfig) string {
+	if cfg == nil {
+		return ""
+	}
+	var parts []string
+	for _, host := range cfg.Hosts {
+		parts = append(parts, "host "+strings.ToLower(host))
+	}
+	for _, h := range cfg.Headers {
+		parts = append(parts, fmt.Sprintf("header %s=%q~%q", http.CanonicalHeaderKey(h.Name), h.Value, h.Regex))
+	}
+	for _, q := range cfg.Query {
+		parts = append(parts, fmt.Sprintf("query %s=%q~%q", q.Name, q.Value, q.Regex))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	sort.Strings(parts)
+	return " when " + strings.Join(parts, ", ")
+}
+
+// checkMatch checks the host patterns and header and query matchers of a
+// route.
+func checkMatch(cfg *config.MatchConfig) []FieldError {
+	var errs []FieldError
+	for i, host := range cfg.Hosts {
+		field := fmt.Sprintf("match.hosts[%d]", i)
+		name := strings.TrimPrefix(host, "*.")
+		switch {
+		case host == "":
+			errs = append(errs, FieldError{Field: field, Message: "host is required"})
+		case strings.ContainsAny(name, "*:/ "):
+			errs = append(errs, FieldError{Field: field, Message: fmt.Sprintf("invalid host %q: use a host name or *.domain", host)})
+		}
+	}
+	for kind, matchers := range map[string][]config.ValueMatcher{"headers": cfg.Headers, "query": cfg.Query} {
+		for i, vm := range matchers {
+			field := fmt.Sprintf("match.%s[%d]", kind, i)
+			if vm.Name == "" {
+				errs = append(errs, FieldError{Field: field + ".name", Message: "name is required"})
+			}
+			if vm.Value != "" && vm.Regex != "" {
+				errs = append(errs, FieldError{Field: field, Message: "set value or regex, not both"})
+			}
+			if vm.Regex != "" {
+				if _, err := regexp.Compile(vm.Regex); err != nil {
+					errs = append(errs, FieldError{Field: field + ".regex", Message: err.Error()})
+				}
+			}
+		}
+	}
+	sort.SliceStable(errs, func(i, j int) bool { return errs[i].Field < errs[j].Field })
+	return errs
+}
+
+// checkRewrite checks that a rewrite template only uses parameters of the
+// route's path and that the regex rules compile.
+func checkRewrite(path string, cfg *config.RewriteConfig) []FieldError {
+	var errs []FieldError
+	if cfg.Path != "" {
+		params := map[string]bool{}
+		for _, param := range pathParams(path) {
+			name, _, _ := strings.Cut(param[1:len(param)-1], ":")
+			params[name] = true
+		}
+		if !strings.HasPrefix(cfg.Path, "/") {
+			errs = append(errs, FieldError{Field: "rewrite.path", Message: "must start with /"})
+		}
+		for _, name := range proxy.Placeholders(cfg.Path) {
+			if !params[name] {
+				errs = append(errs, FieldError{Field: "rewrite.path", Message: fmt.Sprintf("{%s} is not a parameter of the route path", name)})
+			}
+		}
+	}
+	for i, rule := range cfg.Regex {
+		if _, err := regexp.Compile(rule.Match); err != nil {
+			errs = append(errs, FieldError{Field: fmt.Sprintf("rewrite.regex[%d].match", i), Message: err.Error()})
+		}
+	}
+	if cfg.BasePath != "" && !strings.HasPrefix(cfg.BasePath, "/") {
+		errs = append(errs, FieldError{Field: "rewrite.base_path", Message: "must start with /"})
+	}
+	return errs
+}
+
+// paramEnd returns the index of the } closing the parameter that starts
+// with the { at path[start], or -1 if it is not closed. Like chi it counts
+// nested braces, since regular expressions may contain braces of their own,
+// e.g. {id:[0-9]{3}}.
+func paramEnd(path string, start int) int {
+	depth := 0
+	for j := start; j < len(path); j++ {
+		switch path[j] {
+		case '{':
+			depth++
+		case '}':
+			if depth--; depth == 0 {
+				return j
+			}
+		}
+	}
+	return -1
+}
+
+// pathParams returns the parameters of a route path, braces included. A
+// parameter that is not closed ends the list.
+func pathParams(path string) []string {
+	var params []string
+	for i := 0; i < len(path); i++ {
+		if path[i] != '{' {
+			continue
+		}
+		end := paramEnd(path, i)
+		if end < 0 {
+			break
+		}
+		params = append(params, path[i:end+1])
+		i = end
+	}
+	return params
+}
+
+// paramShape replaces every parameter of a chi pattern with {}, so patterns
+// that only differ in parameter names and expressions compare equal.
+func paramShape(pattern string) string {
+	var b strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		if pattern[i] == '{' {
+			if end := paramEnd(pattern, i); end >= 0 {
+				b.WriteString("{}")
+				i = end
+				continue
+			}
+		}
+		b.WriteByte(pattern[i])
+	}
+	return b.String()
+}
+
+// checkPath returns what is wrong with a route path, or "" if chi accepts it.
+func checkPath(path string) string {
+	if path == "" {
+		return "path is required"
+	}
+	if !strings.HasPrefix(path, "/") {
+		return "must start with /"
+	}
+	if i := strings.Index(path, "*"); i >= 0 && i != len(path)-1 {
+		return "* is only allowed at the end of a prefix route"
+	}
+
+	names := map[string]bool{}
+	for i := 0; i < len(path); i++ {
+		switch path[i] {
+		case '}':
+			return "} without matching {"
+		case '{':
+		default:
+			continue
+		}
+		end := paramEnd(path, i)
+		if end < 0 {
+			return "{ without matching }"
+		}
+		name, expr, hasExpr := strings.Cut(path[i+1:end], ":")
+		switch {
+		case name == "":
+			return "parameter without a name"
+		case strings.ContainsAny(name, "{}"):
+			return "parameters cannot be nested"
+		case names[name]:
+			return fmt.Sprintf("parameter %q is used twice", name)
+		}
+		names[name] = true
+		if hasExpr {
+			if _, err := regexp.Compile(expr); err != nil {
+				return fmt.Sprintf("parameter %q: %v", name, err)
+			}
+		}
+		i = end
+	}
+	return ""
+}
+
+// checkUpstream returns what is wrong with an upstream URL, or "".
+func checkUpstream(raw string) string {
+	if raw == "" {
+		return "URL is required"
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return err.Error()
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Sprintf("scheme must be http or https, not %q", u.Scheme)
+	}
+	if u.Host == "" {
+		return "URL has no host"
+	}
+	return ""
+}
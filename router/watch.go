@@ -0,0 +1,49 @@
+package router
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/alxmorales2020/api-gateway/config"
+)
+
+const defaultReloadDebounce = 250 * time.Millisecond
+
+// Watch reloads the router whenever the store reports that routes changed,
+// e.g. through another gateway instance, and returns false if the store
+// cannot be watched. A burst of changes within debounce of each other
+// causes a single reload. Watching stops when ctx is done.
+func (m *Manager) Watch(ctx context.Context, debounce time.Duration) bool {
+	watcher, ok := m.store.(config.RouteWatcher)
+	if !ok {
+		return false
+	}
+	if debounce <= 0 {
+		debounce = defaultReloadDebounce
+	}
+
+	var mu sync.Mutex
+	var timer *time.Timer
+	onChange := func() {
+		mu.Lock()
+		defer mu.Unlock()
+		if timer != nil && timer.Stop() {
+			timer.Reset(debounce)
+			return
+		}
+		timer = time.AfterFunc(debounce, func() {
+			if err := m.Reload(); err != nil {
+				log.Printf("Reload after route store change failed, keeping current routes: %v", err)
+			}
+		})
+	}
+
+	go func() {
+		if err := watcher.Watch(ctx, onChange); err != nil && ctx.Err() == nil {
+			log.Printf("Watching route store stopped: %v", err)
+		}
+	}()
+	return true
+}
@@ -0,0 +1,316 @@
+package test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/alxmorales2020/api-gateway/admin"
+	"github.com/alxmorales2020/api-gateway/config"
+	"github.com/alxmorales2020/api-gateway/router"
+)
+
+// fakeRuntime stands in for the router; with fail set, every candidate
+// router fails to build.
+type fakeRuntime struct {
+	reloads int
+	fail    error
+}
+
+func (f *fakeRuntime) Reload() error { f.reloads++; return f.fail }
+func (f *fakeRuntime) ReloadRoutes(routes []config.RouteConfig, commit func() error) error {
+	if f.fail != nil {
+		return f.fail
+	}
+	f.reloads++
+	return commit()
+}
+func (f *fakeRuntime) DryRun() (*router.ReloadCheck, error) { return &router.ReloadCheck{}, nil }
+func (f *fakeRuntime) Upstreams() []router.UpstreamStatus   { return nil }
+
+func adminRequest(h http.Handler, method, path, contentType, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAdminSingleRoute(t *testing.T) {
+	store := config.NewYAMLRouteStore([]config.RouteConfig{{
+		ID: "r1", Path: "/a", Methods: []string{"GET"}, Upstream: "http://a",
+		Plugins: []config.PluginConfig{{Name: "logging"}},
+	}})
+	runtime := &fakeRuntime{}
+	h := admin.NewAdminHandler(store, runtime).Routes()
+
+	rec := adminRequest(h, http.MethodGet, "/routes/r1", "", "")
+	var got config.RouteConfig
+	if rec.Code != http.StatusOK || json.NewDecoder(rec.Body).Decode(&got) != nil || got.Path != "/a" {
+		t.Fatalf("GET: %d %+v", rec.Code, got)
+	}
+
+	rec = adminRequest(h, http.MethodPatch, "/routes/r1", "application/merge-patch+json",
+		`{"upstream": "http://b", "plugins": null, "strip_prefix": true}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("PATCH: %d %s", rec.Code, rec.Body)
+	}
+	route, _ := store.GetRoute("r1")
+	if route.Upstream != "http://b" || !route.StripPrefix || len(route.Plugins) != 0 || route.Path != "/a" {
+		t.Errorf("after PATCH: %+v", route)
+	}
+
+	rec = adminRequest(h, http.MethodPut, "/routes/r1", "application/json",
+		`{"path": "/c", "methods": ["POST"], "upstream": "http://c"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("PUT: %d %s", rec.Code, rec.Body)
+	}
+	route, _ = store.GetRoute("r1")
+	if route.Path != "/c" || route.StripPrefix || route.Methods[0] != "POST" {
+		t.Errorf("after PUT: %+v", route)
+	}
+	if runtime.reloads != 2 {
+		t.Errorf("reloads = %d, want 2", runtime.reloads)
+	}
+
+	if rec := adminRequest(h, http.MethodPut, "/routes/r1", "", `{"path": "/c", "methods": ["GET"]}`); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("PUT without upstream: %d", rec.Code)
+	}
+	if rec := adminRequest(h, http.MethodPatch, "/routes/r1", "text/plain", `{}`); rec.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("PATCH text/plain: %d", rec.Code)
+	}
+	if rec := adminRequest(h, http.MethodPost, "/routes", "", `{"id": "r1", "path": "/d", "methods": ["GET"], "upstream": "http://d"}`); rec.Code != http.StatusConflict {
+		t.Errorf("POST with a taken ID: %d, want 409", rec.Code)
+	}
+	if route, _ := store.GetRoute("r1"); route.Path != "/c" {
+		t.Errorf("POST with a taken ID changed the route: %+v", route)
+	}
+}
+
+func TestAdminMissingRoute(t *testing.T) {
+	store := config.NewYAMLRouteStore(nil)
+	h := admin.NewAdminHandler(store, &fakeRuntime{}).Routes()
+
+	for _, c := range []struct{ method, body string }{
+		{http.MethodGet, ""},
+		{http.MethodPut, `{"path": "/a", "methods": ["GET"], "upstream": "http://a"}`},
+		{http.MethodPatch, `{"path": "/b"}`},
+		{http.MethodDelete, ""},
+	} {
+		if rec := adminRequest(h, c.method, "/routes/missing", "", c.body); rec.Code != http.StatusNotFound {
+			t.Errorf("%s: status %d, want 404", c.method, rec.Code)
+		}
+	}
+
+	_, err := store.GetRoute("missing")
+	var notFound *config.RouteNotFoundError
+	if !errors.Is(err, config.ErrRouteNotFound) || !errors.As(err, &notFound) || notFound.ID != "missing" {
+		t.Errorf("GetRoute error = %v", err)
+	}
+}
+
+func TestAdminRouteRevisions(t *testing.T) {
+	store := config.NewYAMLRouteStore([]config.RouteConfig{{ID: "r1", Path: "/a", Methods: []string{"GET"}, Upstream: "http://a"}})
+	h := admin.NewAdminHandler(store, &fakeRuntime{}).Routes()
+
+	rec := adminRequest(h, http.MethodGet, "/routes/r1", "", "")
+	if etag := rec.Header().Get("ETag"); etag != `"1"` {
+		t.Fatalf("ETag = %q, want \"1\"", etag)
+	}
+
+	put := func(ifMatch, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/routes/r1", strings.NewReader(body))
+		req.Header.Set("If-Match", ifMatch)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+	first := put(`"1"`, `{"path": "/b", "methods": ["GET"], "upstream": "http://b"}`)
+	if first.Code != http.StatusOK || first.Header().Get("ETag") != `"2"` {
+		t.Fatalf("first PUT: %d ETag %q", first.Code, first.Header().Get("ETag"))
+	}
+	// A second operator still holding revision 1 must not overwrite the change.
+	if rec := put(`"1"`, `{"path": "/c", "methods": ["GET"], "upstream": "http://c"}`); rec.Code != http.StatusPreconditionFailed {
+		t.Errorf("stale PUT: %d, want 412", rec.Code)
+	}
+	if rec := put(`"bogus"`, `{"path": "/c", "methods": ["GET"], "upstream": "http://c"}`); rec.Code != http.StatusPreconditionFailed {
+		t.Errorf("malformed If-Match: %d, want 412", rec.Code)
+	}
+	if route, _ := store.GetRoute("r1"); route.Path != "/b" || route.Revision != 2 {
+		t.Errorf("stored route = %+v", route)
+	}
+
+	req := httptest.NewRequest(http.MethodDelete, "/routes/r1", nil)
+	req.Header.Set("If-Match", `"1"`)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusPreconditionFailed {
+		t.Errorf("stale DELETE: %d, want 412", rec.Code)
+	}
+	if err := store.DeleteRoute("r1", 2); err != nil {
+		t.Errorf("DeleteRoute at current revision: %v", err)
+	}
+}
+
+func TestAdminRouteNotStoredWhenBuildFails(t *testing.T) {
+	store := config.NewYAMLRouteStore([]config.RouteConfig{{ID: "r1", Path: "/a", Methods: []string{"GET"}, Upstream: "http://a"}})
+	h := admin.NewAdminHandler(store, &fakeRuntime{fail: errors.New("building router: boom")}).Routes()
+
+	if rec := adminRequest(h, http.MethodPost, "/routes", "", `{"id": "r2", "path": "/b", "methods": ["GET"], "upstream": "http://b"}`); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("POST: %d, want 422", rec.Code)
+	}
+	if _, err := store.GetRoute("r2"); !errors.Is(err, config.ErrRouteNotFound) {
+		t.Errorf("route stored although the router failed to build: %v", err)
+	}
+	if rec := adminRequest(h, http.MethodPatch, "/routes/r1", "", `{"upstream": "http://c"}`); rec.Code != http.StatusUnprocessableEntity {
+		t.Errorf("PATCH: %d, want 422", rec.Code)
+	}
+	if route, _ := store.GetRoute("r1"); route.Upstream != "http://a" || route.Revision != 1 {
+		t.Errorf("route updated although the router failed to build: %+v", route)
+	}
+	if changes, _ := store.RouteHistory("r1"); len(changes) != 0 {
+		t.Errorf("failed writes recorded in history: %+v", changes)
+	}
+}
+
+func TestAdminHistoryAndRollback(t *testing.T) {
+	store := config.NewYAMLRouteStore(nil)
+	h := admin.NewAdminHandler(store, &fakeRuntime{}).Routes()
+
+	req := httptest.NewRequest(http.MethodPost, "/routes", strings.NewReader(`{"id": "r1", "path": "/a", "methods": ["GET"], "upstream": "http://a"}`))
+	req.Header.Set("X-Admin-User", "alice")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("POST: %d", rec.Code)
+	}
+	adminRequest(h, http.MethodPatch, "/routes/r1", "", `{"upstream": "http://broken"}`)
+
+	rec = adminRequest(h, http.MethodGet, "/routes/r1/history", "", "")
+	var changes []config.RouteChange
+	if err := json.NewDecoder(rec.Body).Decode(&changes); err != nil || len(changes) != 2 {
+		t.Fatalf("history: %v %+v", err, changes)
+	}
+	latest := changes[0]
+	if latest.Action != config.ActionUpdate || latest.Revision != 2 || len(latest.Diff) != 1 ||
+		latest.Diff[0].Field != "upstream" || latest.Diff[0].Before != "http://a" || latest.Diff[0].After != "http://broken" {
+		t.Errorf("latest change = %+v", latest)
+	}
+	if changes[1].Action != config.ActionCreate || changes[1].Actor != "alice" {
+		t.Errorf("first change = %+v", changes[1])
+	}
+
+	rec = adminRequest(h, http.MethodPost, "/routes/r1/rollback?revision=1", "", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("rollback: %d %s", rec.Code, rec.Body)
+	}
+	if route, _ := store.GetRoute("r1"); route.Upstream != "http://a" || route.Revision != 3 {
+		t.Errorf("after rollback: %+v", route)
+	}
+	if rec := adminRequest(h, http.MethodPost, "/routes/r1/rollback?revision=9", "", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown revision: %d", rec.Code)
+	}
+}
+
+func TestAdminRollbackDeletedRoute(t *testing.T) {
+	store := config.NewYAMLRouteStore(nil)
+	h := admin.NewAdminHandler(store, &fakeRuntime{}).Routes()
+
+	adminRequest(h, http.MethodPost, "/routes", "", `{"id": "r1", "path": "/a", "methods": ["GET"], "upstream": "http://a"}`)
+	adminRequest(h, http.MethodPatch, "/routes/r1", "", `{"upstream": "http://b"}`)
+	adminRequest(h, http.MethodDelete, "/routes/r1", "", "")
+
+	rollback := func(revision, ifMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/routes/r1/rollback?revision="+revision, nil)
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+	// The route is gone, so no revision can match.
+	if rec := rollback("1", `"2"`); rec.Code != http.StatusPreconditionFailed {
+		t.Errorf("rollback with If-Match on a deleted route: %d, want 412", rec.Code)
+	}
+
+	// Recreating continues after revision 2 instead of reusing revision 1.
+	rec := rollback("1", "")
+	if rec.Code != http.StatusOK || rec.Header().Get("ETag") != `"3"` {
+		t.Fatalf("rollback to 1: %d ETag %q", rec.Code, rec.Header().Get("ETag"))
+	}
+	req := httptest.NewRequest(http.MethodPut, "/routes/r1", strings.NewReader(`{"path": "/c", "methods": ["GET"], "upstream": "http://c"}`))
+	req.Header.Set("If-Match", `"1"`)
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusPreconditionFailed {
+		t.Errorf("PUT with the ETag of the deleted route: %d, want 412", rec.Code)
+	}
+
+	adminRequest(h, http.MethodDelete, "/routes/r1", "", "")
+	if rec := rollback("3", ""); rec.Code != http.StatusOK || rec.Header().Get("ETag") != `"4"` {
+		t.Fatalf("rollback to 3: %d ETag %q", rec.Code, rec.Header().Get("ETag"))
+	}
+	if route, _ := store.GetRoute("r1"); route.Upstream != "http://a" || route.Revision != 4 {
+		t.Errorf("after second rollback: %+v", route)
+	}
+
+	changes, _ := store.RouteHistory("r1")
+	seen := map[int64]bool{}
+	for _, change := range changes {
+		if change.After == nil {
+			continue
+		}
+		if seen[change.After.Revision] {
+			t.Errorf("revision %d written twice", change.After.Revision)
+		}
+		seen[change.After.Revision] = true
+	}
+}
+
+func TestAdminSnapshotRestore(t *testing.T) {
+	store := config.NewYAMLRouteStore([]config.RouteConfig{
+		{ID: "keep", Path: "/keep", Methods: []string{"GET"}, Upstream: "http://keep"},
+		{ID: "gone", Path: "/gone", Methods: []string{"GET"}, Upstream: "http://gone"},
+	})
+	h := admin.NewAdminHandler(store, &fakeRuntime{}).Routes()
+
+	rec := adminRequest(h, http.MethodPost, "/snapshots", "", `{"note": "before incident"}`)
+	var snapshot config.Snapshot
+	if rec.Code != http.StatusCreated || json.NewDecoder(rec.Body).Decode(&snapshot) != nil {
+		t.Fatalf("snapshot: %d", rec.Code)
+	}
+
+	adminRequest(h, http.MethodPatch, "/routes/keep", "", `{"upstream": "http://bad"}`)
+	adminRequest(h, http.MethodDelete, "/routes/gone", "", "")
+	adminRequest(h, http.MethodPost, "/routes", "", `{"id": "new", "path": "/new", "methods": ["GET"], "upstream": "http://new"}`)
+
+	rec = adminRequest(h, http.MethodPost, "/snapshots/"+snapshot.ID+"/restore", "", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("restore: %d %s", rec.Code, rec.Body)
+	}
+	routes, _ := store.LoadRoutes()
+	got := map[string]string{}
+	for _, route := range routes {
+		got[route.ID] = route.Upstream
+	}
+	if len(got) != 2 || got["keep"] != "http://keep" || got["gone"] != "http://gone" {
+		t.Errorf("routes after restore = %v", got)
+	}
+	if route, _ := store.GetRoute("gone"); route.Revision != 2 {
+		t.Errorf("restored route revision = %d, want 2 after the deleted revision 1", route.Revision)
+	}
+
+	snapshots, _ := store.ListSnapshots()
+	if len(snapshots) != 2 || snapshots[0].Routes != nil {
+		t.Errorf("snapshots = %+v, want the snapshot and a backup without routes", snapshots)
+	}
+	if rec := adminRequest(h, http.MethodPost, "/snapshots/missing/restore", "", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("missing snapshot: %d", rec.Code)
+	}
+}
@@ -0,0 +1,157 @@
+package test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/alxmorales2020/api-gateway/core"
+	"github.com/alxmorales2020/api-gateway/plugins/auth"
+)
+
+func runAuth(t *testing.T, plugin core.Plugin, token string) (*httptest.ResponseRecorder, *http.Request, error) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	req.Header.Set("X-User-Id", "spoofed")
+	rec := httptest.NewRecorder()
+	req = core.WithRequestContext(req, &core.RequestContext{Writer: rec})
+	return rec, req, plugin.Execute(rec, req)
+}
+
+func TestJWTAuthHS256(t *testing.T) {
+	plugin := auth.New()
+	err := plugin.Init(map[string]interface{}{
+		"secret":         "s3cret",
+		"issuer":         "me",
+		"audience":       []interface{}{"api"},
+		"forward_claims": map[string]interface{}{"sub": "X-User-Id"},
+	})
+	if err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+
+	sign := func(claims jwt.MapClaims, secret string) string {
+		s, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	valid := jwt.MapClaims{"sub": "alice", "iss": "me", "aud": "api", "exp": time.Now().Add(time.Minute).Unix()}
+
+	_, req, err := runAuth(t, plugin, sign(valid, "s3cret"))
+	if err != nil {
+		t.Fatalf("valid token rejected: %v", err)
+	}
+	if got := req.Header.Get("X-User-Id"); got != "alice" {
+		t.Errorf("forwarded claim = %q", got)
+	}
+	if rc := core.GetRequestContext(req); rc.Claims["sub"] != "alice" {
+		t.Errorf("claims not exposed: %v", rc.Claims)
+	}
+
+	expired := jwt.MapClaims{"sub": "alice", "iss": "me", "aud": "api", "exp": time.Now().Add(-time.Minute).Unix()}
+	wrongAud := jwt.MapClaims{"sub": "alice", "iss": "me", "aud": "other"}
+	for name, token := range map[string]string{
+		"missing":   "",
+		"bad sig":   sign(valid, "other"),
+		"expired":   sign(expired, "s3cret"),
+		"wrong aud": sign(wrongAud, "s3cret"),
+	} {
+		rec, _, err := runAuth(t, plugin, token)
+		if err == nil || rec.Code != http.StatusUnauthorized {
+			t.Errorf("%s: expected 401, got %d (%v)", name, rec.Code, err)
+		}
+	}
+}
+
+func TestJWTAuthES256JWKS(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc := base64.RawURLEncoding.EncodeToString
+	jwks, _ := json.Marshal(map[string]interface{}{"keys": []map[string]string{{
+		"kty": "EC", "kid": "k1", "crv": "P-256", "use": "sig",
+		"x": enc(key.X.FillBytes(make([]byte, 32))),
+		"y": enc(key.Y.FillBytes(make([]byte, 32))),
+	}}})
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, jwks, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	plugin := auth.New()
+	if err := plugin.Init(map[string]interface{}{"jwks_file": path}); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{"sub": "bob"})
+	token.Header["kid"] = "k1"
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := runAuth(t, plugin, signed); err != nil {
+		t.Fatalf("valid ES256 token rejected: %v", err)
+	}
+}
+
+func TestJWTAuthJWKSSkipsOctKeys(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := []byte("published-secret")
+	enc := base64.RawURLEncoding.EncodeToString
+	jwks, _ := json.Marshal(map[string]interface{}{"keys": []map[string]string{
+		{"kty": "oct", "kid": "shared", "k": enc(secret)},
+		{
+			"kty": "EC", "kid": "k1", "crv": "P-256",
+			"x": enc(key.X.FillBytes(make([]byte, 32))),
+			"y": enc(key.Y.FillBytes(make([]byte, 32))),
+		},
+	}})
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, jwks, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	plugin := auth.New()
+	cfg := map[string]interface{}{"jwks_file": path, "algorithms": []interface{}{"HS256", "ES256"}}
+	if err := plugin.Init(cfg); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+
+	hs := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "mallory"})
+	hs.Header["kid"] = "shared"
+	signed, err := hs.SignedString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := runAuth(t, plugin, signed); err == nil {
+		t.Fatal("token signed with a JWKS oct key was accepted")
+	}
+
+	es := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{"sub": "bob"})
+	es.Header["kid"] = "k1"
+	if signed, err = es.SignedString(key); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := runAuth(t, plugin, signed); err != nil {
+		t.Fatalf("valid ES256 token rejected: %v", err)
+	}
+}
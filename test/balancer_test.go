@@ -0,0 +1,96 @@
+package test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alxmorales2020/api-gateway/config"
+	"github.com/alxmorales2020/api-gateway/proxy"
+)
+
+func namedUpstream(t *testing.T, name string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, name)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func weight(n int) *int { return &n }
+
+func hit(t *testing.T, h http.Handler, mutate func(*http.Request)) string {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/x", nil)
+	if mutate != nil {
+		mutate(req)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec.Body.String()
+}
+
+func TestWeightedRoundRobin(t *testing.T) {
+	a, b := namedUpstream(t, "a"), namedUpstream(t, "b")
+	p, err := proxy.NewReverseProxy(config.RouteConfig{Pool: &config.UpstreamPool{
+		Balancer: "weighted-round-robin",
+		Targets:  []config.UpstreamTarget{{URL: a.URL, Weight: weight(3)}, {URL: b.URL, Weight: weight(1)}},
+	}}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	counts := map[string]int{}
+	for i := 0; i < 8; i++ {
+		counts[hit(t, p, nil)]++
+	}
+	if counts["a"] != 6 || counts["b"] != 2 {
+		t.Errorf("distribution = %v, want a:6 b:2", counts)
+	}
+}
+
+func TestZeroWeightDrainsTarget(t *testing.T) {
+	a, b := namedUpstream(t, "a"), namedUpstream(t, "b")
+	for _, balancer := range []string{"round-robin", "weighted-round-robin", "least-connections", "random-two-choices", "consistent-hash"} {
+		p, err := proxy.NewReverseProxy(config.RouteConfig{Pool: &config.UpstreamPool{
+			Balancer: balancer,
+			HashOn:   "header",
+			HashKey:  "X-User",
+			Targets:  []config.UpstreamTarget{{URL: a.URL, Weight: weight(0)}, {URL: b.URL}},
+		}}, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, user := range []string{"alice", "bob", "carol", "dave"} {
+			if got := hit(t, p, func(r *http.Request) { r.Header.Set("X-User", user) }); got != "b" {
+				t.Errorf("%s: request for %s went to %s", balancer, user, got)
+			}
+		}
+		p.Close()
+	}
+}
+
+func TestConsistentHashOnHeader(t *testing.T) {
+	a, b, c := namedUpstream(t, "a"), namedUpstream(t, "b"), namedUpstream(t, "c")
+	p, err := proxy.NewReverseProxy(config.RouteConfig{Pool: &config.UpstreamPool{
+		Balancer: "consistent-hash",
+		HashOn:   "header",
+		HashKey:  "X-User",
+		Targets:  []config.UpstreamTarget{{URL: a.URL}, {URL: b.URL}, {URL: c.URL}},
+	}}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, user := range []string{"alice", "bob", "carol", "dave"} {
+		setUser := func(r *http.Request) { r.Header.Set("X-User", user) }
+		first := hit(t, p, setUser)
+		for i := 0; i < 5; i++ {
+			if got := hit(t, p, setUser); got != first {
+				t.Fatalf("user %s moved from %s to %s", user, first, got)
+			}
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/alxmorales2020/api-gateway/config"
+	"github.com/alxmorales2020/api-gateway/core"
+	"github.com/alxmorales2020/api-gateway/plugins/body"
+	"github.com/alxmorales2020/api-gateway/router"
+)
+
+func TestBodyTransform(t *testing.T) {
+	core.RegisterPlugin("body-transform", body.New)
+
+	var received string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		received = string(data)
+		if r.URL.Path == "/text" {
+			w.Header().Set("Content-Type", "text/plain")
+			io.WriteString(w, `{"status":"ok"}`)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		if r.URL.Path == "/big" {
+			io.WriteString(w, `{"status":"ok","data":"`+strings.Repeat("x", 200)+`"}`)
+			return
+		}
+		io.WriteString(w, `{"status":"ok","data":{"items":[{"id":1,"secret":"a","usr":"x<y"},{"id":2,"secret":"b"}],"total":2}}`)
+	}))
+	defer upstream.Close()
+
+	routes := []config.RouteConfig{{
+		Path: "/*", Methods: []string{"POST"}, Upstream: upstream.URL,
+		Plugins: []config.PluginConfig{{Name: "body-transform", Config: map[string]interface{}{
+			"max_body_bytes": 150,
+			"request": []interface{}{
+				map[string]interface{}{"op": "rename", "path": "$.userName", "to": "user_name"},
+				map[string]interface{}{"op": "add", "path": "$.meta.source", "value": "gateway"},
+				map[string]interface{}{"op": "wrap", "field": "payload"},
+			},
+			"response": []interface{}{
+				map[string]interface{}{"op": "unwrap", "field": "data"},
+				map[string]interface{}{"op": "remove", "path": "$.items[*].secret"},
+				map[string]interface{}{"op": "rename", "path": "$.items[*].usr", "to": "user"},
+			},
+		}}},
+	}}
+	if err := router.ValidateRoutes(routes); err != nil {
+		t.Fatal(err)
+	}
+	manager, err := router.NewManager(config.NewYAMLRouteStore(routes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	post := func(path, contentType, payload string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(payload))
+		req.Header.Set("Content-Type", contentType)
+		rec := httptest.NewRecorder()
+		manager.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := post("/orders", "application/json", `{"userName":"alice","n":12345678901234567890}`)
+	if want := `{"payload":{"meta":{"source":"gateway"},"n":12345678901234567890,"user_name":"alice"}}`; received != want {
+		t.Errorf("upstream received %s, want %s", received, want)
+	}
+	want := `{"items":[{"id":1,"user":"x<y"},{"id":2}],"total":2}`
+	if rec.Body.String() != want || rec.Header().Get("Content-Length") != strconv.Itoa(len(want)) {
+		t.Errorf("response %q (Content-Length %s), want %s", rec.Body, rec.Header().Get("Content-Length"), want)
+	}
+
+	if rec := post("/text", "text/plain", `{"userName":"alice"}`); received != `{"userName":"alice"}` || rec.Body.String() != `{"status":"ok"}` {
+		t.Errorf("non-JSON bodies changed: sent %s, got %s", received, rec.Body)
+	}
+	if rec := post("/orders", "application/json", `{not json`); received != `{not json` || rec.Code != http.StatusOK {
+		t.Errorf("invalid JSON changed: sent %s, got %d", received, rec.Code)
+	}
+	if rec := post("/big", "application/json", `{}`); !strings.HasPrefix(rec.Body.String(), `{"status":"ok","data":"xxx`) {
+		t.Errorf("response above the limit was changed: %s", rec.Body)
+	}
+	if rec := post("/orders", "application/json", `{"a":"`+strings.Repeat("x", 200)+`"}`); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("request above the limit: %d", rec.Code)
+	}
+}
+
+func TestBodyTransformExtract(t *testing.T) {
+	cases := []struct {
+		path, doc, want string
+	}{
+		{"$.data.items[*].id", `{"data":{"items":[{"id":1},{"id":2}]}}`, `[1,2]`},
+		{"$.data['items'][-1]", `{"data":{"items":[{"id":1},{"id":2}]}}`, `{"id":2}`},
+		{"$.missing", `{"a":1}`, `null`},
+		{"$.*", `{"b":2,"a":1}`, `[1,2]`},
+	}
+	for _, tc := range cases {
+		plugin := body.New().(*body.BodyTransformPlugin)
+		err := plugin.Init(map[string]interface{}{"response": []interface{}{map[string]interface{}{"op": "extract", "path": tc.path}}})
+		if err != nil {
+			t.Fatalf("%s: %v", tc.path, err)
+		}
+		resp := &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": {"application/vnd.api+json"}},
+			Body:       io.NopCloser(strings.NewReader(tc.doc)),
+			Request:    httptest.NewRequest(http.MethodGet, "/", nil),
+		}
+		if err := plugin.UpstreamResponse(&core.RequestContext{}, resp); err != nil {
+			t.Fatal(err)
+		}
+		got, _ := io.ReadAll(resp.Body)
+		if string(got) != tc.want {
+			t.Errorf("extract %s from %s = %s, want %s", tc.path, tc.doc, got, tc.want)
+		}
+	}
+
+	for _, bad := range []string{"data", "$.a[x]", "$.a["} {
+		err := body.New().Init(map[string]interface{}{"request": []interface{}{map[string]interface{}{"op": "extract", "path": bad}}})
+		if err == nil {
+			t.Errorf("path %q accepted", bad)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package test
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alxmorales2020/api-gateway/config"
+)
+
+func openBoltStore(t *testing.T, path string) *config.BoltRouteStore {
+	t.Helper()
+	store, err := config.NewBoltRouteStore(&config.BoltConfig{Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestBoltRouteStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gateway.db")
+	store := openBoltStore(t, path)
+
+	route := &config.RouteConfig{Path: "/a", Methods: []string{"GET"}, Upstream: "http://a"}
+	if err := store.SaveRoute(route); err != nil {
+		t.Fatal(err)
+	}
+	if route.ID == "" || route.Revision != 1 {
+		t.Fatalf("saved route: id %q revision %d", route.ID, route.Revision)
+	}
+	if err := store.SaveRoute(&config.RouteConfig{ID: route.ID, Path: "/dup"}); !errors.Is(err, config.ErrRouteExists) {
+		t.Errorf("duplicate ID: %v, want ErrRouteExists", err)
+	}
+
+	update := *route
+	update.Upstream = "http://b"
+	if err := store.UpdateRoute(&update, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.UpdateRoute(&update, 1); !errors.Is(err, config.ErrRevisionMismatch) {
+		t.Errorf("stale update: %v, want revision mismatch", err)
+	}
+	if err := store.DeleteRoute("missing", config.AnyRevision); !errors.Is(err, config.ErrRouteNotFound) {
+		t.Errorf("delete missing: %v, want not found", err)
+	}
+
+	for i, action := range []string{config.ActionCreate, config.ActionUpdate} {
+		change := &config.RouteChange{RouteID: route.ID, Revision: int64(i + 1), Action: action, Time: time.Now()}
+		if err := store.RecordChange(change); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.SaveSnapshot(&config.Snapshot{Time: time.Now(), Routes: []config.RouteConfig{*route}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Everything survives reopening the file.
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+	store = openBoltStore(t, path)
+	defer store.Close()
+
+	got, err := store.GetRoute(route.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Upstream != "http://b" || got.Revision != 2 {
+		t.Errorf("reopened route: upstream %q revision %d", got.Upstream, got.Revision)
+	}
+	history, _ := store.RouteHistory(route.ID)
+	if len(history) != 2 || history[0].Action != config.ActionUpdate {
+		t.Errorf("history = %+v, want update then create", history)
+	}
+	snapshots, _ := store.ListSnapshots()
+	if len(snapshots) != 1 || snapshots[0].Routes != nil {
+		t.Errorf("snapshots = %+v, want one without routes", snapshots)
+	}
+
+	if err := store.DeleteRoute(route.ID, 2); err != nil {
+		t.Fatal(err)
+	}
+	if routes, _ := store.LoadRoutes(); len(routes) != 0 {
+		t.Errorf("routes after delete = %+v", routes)
+	}
+}
+
+func TestBoltRouteStoreImport(t *testing.T) {
+	src := config.NewYAMLRouteStore([]config.RouteConfig{
+		{ID: "kept", Revision: 4, Path: "/a", Methods: []string{"GET"}},
+		{Path: "/b", Methods: []string{"GET"}},
+	})
+	_ = src.RecordChange(&config.RouteChange{RouteID: "kept", Revision: 4, Action: config.ActionUpdate, Time: time.Now()})
+	_ = src.SaveSnapshot(&config.Snapshot{ID: "snap", Time: time.Now()})
+
+	store := openBoltStore(t, filepath.Join(t.TempDir(), "gateway.db"))
+	defer store.Close()
+	if n, err := store.Import(src); err != nil || n != 2 {
+		t.Fatalf("import = %d, %v; want 2 routes", n, err)
+	}
+
+	got, err := store.GetRoute("kept")
+	if err != nil || got.Revision != 4 {
+		t.Fatalf("imported route = %+v, %v; want ID and revision kept", got, err)
+	}
+	if history, _ := store.RouteHistory("kept"); len(history) != 1 {
+		t.Errorf("imported history = %+v", history)
+	}
+	if _, err := store.GetSnapshot("snap"); err != nil {
+		t.Errorf("imported snapshot: %v", err)
+	}
+
+	// A database that already has routes is left alone.
+	if n, err := store.Import(config.NewYAMLRouteStore([]config.RouteConfig{{Path: "/c"}})); err != nil || n != 0 {
+		t.Errorf("second import = %d, %v; want nothing imported", n, err)
+	}
+}
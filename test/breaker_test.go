@@ -0,0 +1,69 @@
+package test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alxmorales2020/api-gateway/config"
+	"github.com/alxmorales2020/api-gateway/proxy"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	var calls, failing int32 = 0, 1
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		if atomic.LoadInt32(&failing) == 1 {
+			http.Error(w, "down", http.StatusBadGateway)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer upstream.Close()
+
+	p, err := proxy.NewReverseProxy(config.RouteConfig{
+		Path:     "/breaker",
+		Upstream: upstream.URL,
+		CircuitBreaker: &config.CircuitBreakerConfig{
+			ConsecutiveFailures: 3,
+			OpenDuration:        config.Duration(50 * time.Millisecond),
+			OpenStatus:          http.StatusTooManyRequests,
+			OpenBody:            "try later",
+		},
+	}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	serve := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		p.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		return rec
+	}
+
+	for i := 0; i < 3; i++ {
+		serve()
+	}
+	if state := p.BreakerStatus().State; state != "open" {
+		t.Fatalf("breaker state = %s, want open", state)
+	}
+	rec := serve()
+	if rec.Code != http.StatusTooManyRequests || rec.Body.String() != "try later\n" {
+		t.Errorf("open breaker answered %d %q", rec.Code, rec.Body.String())
+	}
+	if n := atomic.LoadInt32(&calls); n != 3 {
+		t.Errorf("upstream called %d times, want 3", n)
+	}
+
+	atomic.StoreInt32(&failing, 0)
+	time.Sleep(60 * time.Millisecond)
+	if rec := serve(); rec.Code != http.StatusOK {
+		t.Fatalf("half-open trial answered %d", rec.Code)
+	}
+	if state := p.BreakerStatus().State; state != "closed" {
+		t.Errorf("breaker state = %s, want closed", state)
+	}
+}
@@ -0,0 +1,279 @@
+package test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/alxmorales2020/api-gateway/admin"
+	"github.com/alxmorales2020/api-gateway/config"
+	"github.com/alxmorales2020/api-gateway/core"
+	"github.com/alxmorales2020/api-gateway/plugins/auth"
+	"github.com/alxmorales2020/api-gateway/plugins/cache"
+	"github.com/alxmorales2020/api-gateway/router"
+)
+
+func TestCachePlugin(t *testing.T) {
+	core.RegisterPlugin("cache", cache.New)
+
+	var calls, conditional int64
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&calls, 1)
+		switch r.URL.Path {
+		case "/items":
+			w.Header().Set("Cache-Control", "max-age=60")
+			w.Header().Set("ETag", `"v1"`)
+			w.Header().Set("Vary", "Accept-Language")
+			w.Write([]byte("items " + r.Header.Get("Accept-Language") + " " + r.URL.Query().Get("page")))
+		case "/revalidate":
+			w.Header().Set("Cache-Control", "no-cache")
+			w.Header().Set("ETag", `"r1"`)
+			if r.Header.Get("If-None-Match") == `"r1"` {
+				atomic.AddInt64(&conditional, 1)
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Write([]byte("fresh copy"))
+		case "/private":
+			w.Header().Set("Cache-Control", "no-store")
+			w.Write([]byte("secret"))
+		default:
+			w.Header().Set("Cache-Control", "max-age=60")
+			w.Write([]byte(strings.Repeat("x", 100)))
+		}
+	}))
+	defer upstream.Close()
+
+	dir := t.TempDir()
+	plugin := func(cfg map[string]interface{}) []config.PluginConfig {
+		return []config.PluginConfig{{Name: "cache", Config: cfg}}
+	}
+	routes := []config.RouteConfig{
+		{ID: "items", Path: "/items", Methods: []string{"GET"}, Upstream: upstream.URL,
+			Plugins: plugin(map[string]interface{}{"query_params": []interface{}{"page"}})},
+		{ID: "revalidate", Path: "/revalidate", Methods: []string{"GET"}, Upstream: upstream.URL, Plugins: plugin(nil)},
+		{ID: "private", Path: "/private", Methods: []string{"GET"}, Upstream: upstream.URL, Plugins: plugin(nil)},
+		{ID: "small", Path: "/small/*", Methods: []string{"GET"}, Upstream: upstream.URL,
+			Plugins: plugin(map[string]interface{}{"max_bytes": 400})},
+		{ID: "disk", Path: "/disk/*", Methods: []string{"GET"}, Upstream: upstream.URL,
+			Plugins: plugin(map[string]interface{}{"storage": "disk", "dir": dir})},
+	}
+	if err := router.ValidateRoutes(routes); err != nil {
+		t.Fatal(err)
+	}
+	store := config.NewYAMLRouteStore(routes)
+	manager, err := router.NewManager(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	get := func(target string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		rec := httptest.NewRecorder()
+		manager.ServeHTTP(rec, req)
+		return rec
+	}
+	expect := func(rec *httptest.ResponseRecorder, xcache, body string) {
+		t.Helper()
+		if rec.Header().Get("X-Cache") != xcache || (body != "" && rec.Body.String() != body) {
+			t.Errorf("got %d %q X-Cache %q, want %q X-Cache %q", rec.Code, rec.Body, rec.Header().Get("X-Cache"), body, xcache)
+		}
+	}
+
+	english := http.Header{"Accept-Language": {"en"}}
+	expect(get("/items?page=1&utm=a", english), "MISS", "items en 1")
+	expect(get("/items?utm=b&page=1", english), "HIT", "items en 1")
+	expect(get("/items?page=1", http.Header{"Accept-Language": {"de"}}), "MISS", "items de 1")
+	expect(get("/items?page=2", english), "MISS", "items en 2")
+	if rec := get("/items?page=1", http.Header{"Accept-Language": {"en"}, "If-None-Match": {`"v1"`}}); rec.Code != http.StatusNotModified {
+		t.Errorf("conditional hit: %d", rec.Code)
+	}
+	if calls != 3 {
+		t.Errorf("upstream called %d times, want 3", calls)
+	}
+
+	expect(get("/revalidate", nil), "MISS", "fresh copy")
+	expect(get("/revalidate", nil), "HIT", "fresh copy")
+	if conditional != 1 {
+		t.Errorf("stale entry revalidated %d times, want 1", conditional)
+	}
+
+	expect(get("/private", nil), "MISS", "secret")
+	expect(get("/private", nil), "MISS", "secret")
+
+	// Entries of about 130 bytes: the fourth evicts the first.
+	for _, target := range []string{"/small/1", "/small/2", "/small/3", "/small/4"} {
+		expect(get(target, nil), "MISS", "")
+	}
+	expect(get("/small/4", nil), "HIT", "")
+	expect(get("/small/1", nil), "MISS", "")
+
+	expect(get("/disk/a", nil), "MISS", "")
+	expect(get("/disk/a", nil), "HIT", strings.Repeat("x", 100))
+	if files, _ := os.ReadDir(dir); len(files) != 1 {
+		t.Errorf("disk storage holds %d files, want 1", len(files))
+	}
+
+	// Three variants of /items plus the Vary markers of its two keys.
+	h := admin.NewAdminHandler(store, manager).Routes()
+	if rec := adminRequest(h, http.MethodDelete, "/cache?route=items", "", ""); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"purged":5`) {
+		t.Errorf("purge items: %d %s", rec.Code, rec.Body)
+	}
+	expect(get("/items?page=1", english), "MISS", "")
+	expect(get("/revalidate", nil), "HIT", "")
+	if rec := adminRequest(h, http.MethodDelete, "/cache?prefix=disk+GET+/disk/", "", ""); !strings.Contains(rec.Body.String(), `"purged":1`) {
+		t.Errorf("purge by prefix: %s", rec.Body)
+	}
+	if files, _ := os.ReadDir(dir); len(files) != 0 {
+		t.Errorf("disk storage holds %d files after purge", len(files))
+	}
+	if rec := adminRequest(h, http.MethodDelete, "/cache", "", ""); rec.Code != http.StatusBadRequest {
+		t.Errorf("purge without route or prefix: %d", rec.Code)
+	}
+}
+
+func TestCachePurgeAfterRestart(t *testing.T) {
+	core.RegisterPlugin("cache", cache.New)
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write([]byte("cached"))
+	}))
+	defer upstream.Close()
+
+	routes := func(dir string) *config.YAMLRouteStore {
+		return config.NewYAMLRouteStore([]config.RouteConfig{{ID: "restart", Path: "/restart/*", Methods: []string{"GET"}, Upstream: upstream.URL,
+			Plugins: []config.PluginConfig{{Name: "cache", Config: map[string]interface{}{"storage": "disk", "dir": dir}}}}})
+	}
+	before, after := t.TempDir(), t.TempDir()
+	manager, err := router.NewManager(routes(before))
+	if err != nil {
+		t.Fatal(err)
+	}
+	manager.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/restart/a", nil))
+
+	// The files of a gateway that ran before: nothing has opened them yet.
+	files, _ := os.ReadDir(before)
+	if len(files) != 1 {
+		t.Fatalf("disk storage holds %d files, want 1", len(files))
+	}
+	data, _ := os.ReadFile(filepath.Join(before, files[0].Name()))
+	if err := os.WriteFile(filepath.Join(after, files[0].Name()), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cache.Purge("restart ")
+
+	if _, err := router.NewManager(routes(after)); err != nil {
+		t.Fatal(err)
+	}
+	if n := cache.Purge("restart "); n != 1 {
+		t.Errorf("purge before any request purged %d entries, want 1", n)
+	}
+	if files, _ := os.ReadDir(after); len(files) != 0 {
+		t.Errorf("disk storage holds %d files after purge", len(files))
+	}
+}
+
+func TestCacheBehindAuth(t *testing.T) {
+	core.RegisterPlugin("cache", cache.New)
+	core.RegisterPlugin("jwt-auth", auth.New)
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "public, max-age=60")
+		w.Write([]byte("report"))
+	}))
+	defer upstream.Close()
+
+	jwtAuth := config.PluginConfig{Name: "jwt-auth", Config: map[string]interface{}{"secret": "s3cret"}}
+	cached := config.PluginConfig{Name: "cache"}
+	routes := []config.RouteConfig{{ID: "reports", Path: "/reports", Methods: []string{"GET"}, Upstream: upstream.URL,
+		Plugins: []config.PluginConfig{cached, jwtAuth}}}
+	var invalid *router.ValidationError
+	if err := router.ValidateRoutes(routes); !errors.As(err, &invalid) || invalid.Errors[0].Field != "routes[0].plugins[1].name" {
+		t.Errorf("cache before jwt-auth: %v", err)
+	}
+
+	routes[0].Plugins = []config.PluginConfig{jwtAuth, cached}
+	manager, err := router.NewManager(config.NewYAMLRouteStore(routes))
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": "alice", "exp": time.Now().Add(time.Minute).Unix(),
+	}).SignedString([]byte("s3cret"))
+	get := func(authorization string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/reports", nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		rec := httptest.NewRecorder()
+		manager.ServeHTTP(rec, req)
+		return rec
+	}
+	get("Bearer " + token)
+	if rec := get("Bearer " + token); rec.Header().Get("X-Cache") != "HIT" {
+		t.Errorf("authorized request: %d X-Cache %q, want a hit", rec.Code, rec.Header().Get("X-Cache"))
+	}
+	if rec := get(""); rec.Code != http.StatusUnauthorized || rec.Body.String() == "report" {
+		t.Errorf("unauthenticated request: %d %q, want 401", rec.Code, rec.Body)
+	}
+}
+
+func TestCacheUnregisteredStorage(t *testing.T) {
+	core.RegisterPlugin("cache", cache.New)
+
+	routes := []config.RouteConfig{{ID: "custom", Path: "/custom", Methods: []string{"GET"}, Upstream: "http://custom",
+		Plugins: []config.PluginConfig{{Name: "cache", Config: map[string]interface{}{"storage": "custom"}}}}}
+	if err := router.ValidateRoutes(routes); err == nil || !strings.Contains(err.Error(), `storage "custom" is not registered`) {
+		t.Errorf("unregistered storage: %v", err)
+	}
+	cache.RegisterStorage("custom", nopStorage{})
+	if err := router.ValidateRoutes(routes); err != nil {
+		t.Errorf("registered storage: %v", err)
+	}
+}
+
+type nopStorage struct{}
+
+func (nopStorage) Get(string) (*cache.Entry, bool) { return nil, false }
+func (nopStorage) Set(string, *cache.Entry)        {}
+func (nopStorage) Purge(string) int                { return 0 }
+
+func TestCacheHeadKeepsContentLength(t *testing.T) {
+	core.RegisterPlugin("cache", cache.New)
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Content-Length", "42")
+		if r.Method != http.MethodHead {
+			w.Write([]byte(strings.Repeat("x", 42)))
+		}
+	}))
+	defer upstream.Close()
+
+	manager, err := router.NewManager(config.NewYAMLRouteStore([]config.RouteConfig{{
+		ID: "head", Path: "/head", Methods: []string{"GET", "HEAD"}, Upstream: upstream.URL,
+		Plugins: []config.PluginConfig{{Name: "cache"}},
+	}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, xcache := range []string{"MISS", "HIT"} {
+		rec := httptest.NewRecorder()
+		manager.ServeHTTP(rec, httptest.NewRequest(http.MethodHead, "/head", nil))
+		if rec.Header().Get("X-Cache") != xcache || rec.Header().Get("Content-Length") != "42" || rec.Body.Len() != 0 {
+			t.Errorf("HEAD: X-Cache %q Content-Length %q body %d bytes, want %s with length 42 and no body",
+				rec.Header().Get("X-Cache"), rec.Header().Get("Content-Length"), rec.Body.Len(), xcache)
+		}
+	}
+}
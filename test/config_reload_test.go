@@ -0,0 +1,103 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alxmorales2020/api-gateway/config"
+	"github.com/alxmorales2020/api-gateway/core"
+	"github.com/alxmorales2020/api-gateway/plugins/ratelimit"
+	"github.com/alxmorales2020/api-gateway/router"
+)
+
+func TestWatchFilesFollowsReplacedFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	if err := os.WriteFile(path, []byte("routes: []\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	changed := make(chan struct{}, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go config.WatchFiles(ctx, []string{path}, 20*time.Millisecond, func() { changed <- struct{}{} })
+	time.Sleep(100 * time.Millisecond)
+
+	// Editors save by writing a temp file and renaming it over the original.
+	for i := 0; i < 2; i++ {
+		tmp := filepath.Join(dir, "config.yaml.tmp")
+		if err := os.WriteFile(tmp, []byte(fmt.Sprintf("routes: []\n# edit %d\n", i)), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Rename(tmp, path); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case <-changed:
+		case <-time.After(3 * time.Second):
+			t.Fatalf("change %d not noticed", i+1)
+		}
+	}
+}
+
+func TestReloadRoutesKeepsLastGoodConfig(t *testing.T) {
+	core.RegisterPlugin("rate-limit", ratelimit.New)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer upstream.Close()
+
+	store := config.NewYAMLRouteStore([]config.RouteConfig{{Path: "/old", Methods: []string{"GET"}, Upstream: upstream.URL}})
+	manager, err := router.NewManager(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	invalid := store.Resolve([]config.RouteConfig{{
+		Path:     "/new",
+		Methods:  []string{"GET"},
+		Upstream: upstream.URL,
+		Plugins:  []config.PluginConfig{{Name: "rate-limit", Config: map[string]interface{}{"algorithm": "bogus"}}},
+	}})
+	committed := false
+	err = manager.ReloadRoutes(invalid, func() error {
+		committed = true
+		return store.ReplaceRoutes(invalid)
+	})
+	if err == nil {
+		t.Fatal("invalid plugin config was accepted")
+	}
+	if committed {
+		t.Error("store was updated although the routes were rejected")
+	}
+	if code := statusOf(manager, "/old"); code != http.StatusOK {
+		t.Errorf("old route after rejected reload: %d, want 200", code)
+	}
+
+	valid := store.Resolve([]config.RouteConfig{{Path: "/new", Methods: []string{"GET"}, Upstream: upstream.URL}})
+	failing := errors.New("disk full")
+	if err := manager.ReloadRoutes(valid, func() error { return failing }); !errors.Is(err, failing) {
+		t.Fatalf("commit error not returned: %v", err)
+	}
+	if code := statusOf(manager, "/new"); code != http.StatusNotFound {
+		t.Errorf("new route served although the commit failed: %d", code)
+	}
+
+	if err := manager.ReloadRoutes(valid, func() error { return store.ReplaceRoutes(valid) }); err != nil {
+		t.Fatal(err)
+	}
+	if code := statusOf(manager, "/new"); code != http.StatusOK {
+		t.Errorf("new route after reload: %d, want 200", code)
+	}
+}
+
+func statusOf(handler http.Handler, path string) int {
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	return rec.Code
+}
@@ -0,0 +1,80 @@
+package test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/alxmorales2020/api-gateway/config"
+)
+
+func TestPluginConfigYAML(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	data := []byte(`
+routes:
+  - path: /a
+    methods: [GET]
+    upstream: http://a
+    strip_prefix: true
+    plugins:
+      - logging
+      - name: jwt-auth
+        config:
+          issuer: me
+          nested:
+            key: value
+`)
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := config.LoadConfig(path)
+	if err != nil {
+		t.Fatalf("LoadConfig: %v", err)
+	}
+	route := cfg.Routes[0]
+	if !route.StripPrefix {
+		t.Error("strip_prefix not decoded")
+	}
+	if len(route.Plugins) != 2 || route.Plugins[0].Name != "logging" || route.Plugins[1].Name != "jwt-auth" {
+		t.Fatalf("unexpected plugins: %+v", route.Plugins)
+	}
+	nested, ok := route.Plugins[1].Config["nested"].(map[string]interface{})
+	if !ok || nested["key"] != "value" {
+		t.Errorf("nested config not normalized: %#v", route.Plugins[1].Config["nested"])
+	}
+}
+
+func TestPluginConfigJSONAndBSON(t *testing.T) {
+	var route config.RouteConfig
+	body := `{"path":"/a","methods":["GET"],"upstream":"http://a","plugins":["logging",{"name":"jwt-auth","config":{"issuer":"me"}}]}`
+	if err := json.Unmarshal([]byte(body), &route); err != nil {
+		t.Fatalf("json: %v", err)
+	}
+	if len(route.Plugins) != 2 || route.Plugins[1].Config["issuer"] != "me" {
+		t.Fatalf("unexpected plugins: %+v", route.Plugins)
+	}
+
+	raw, err := bson.Marshal(route)
+	if err != nil {
+		t.Fatalf("bson marshal: %v", err)
+	}
+	var decoded config.RouteConfig
+	if err := bson.Unmarshal(raw, &decoded); err != nil {
+		t.Fatalf("bson unmarshal: %v", err)
+	}
+	if len(decoded.Plugins) != 2 || decoded.Plugins[1].Config["issuer"] != "me" {
+		t.Fatalf("unexpected plugins after bson round trip: %+v", decoded.Plugins)
+	}
+
+	legacy, _ := bson.Marshal(bson.M{"path": "/a", "plugins": bson.A{"logging"}})
+	if err := bson.Unmarshal(legacy, &decoded); err != nil {
+		t.Fatalf("legacy bson: %v", err)
+	}
+	if decoded.Plugins[0].Name != "logging" {
+		t.Fatalf("legacy plugin name not decoded: %+v", decoded.Plugins)
+	}
+}
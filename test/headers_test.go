@@ -0,0 +1,109 @@
+package test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/alxmorales2020/api-gateway/config"
+	"github.com/alxmorales2020/api-gateway/core"
+	"github.com/alxmorales2020/api-gateway/plugins/auth"
+	"github.com/alxmorales2020/api-gateway/plugins/headers"
+	"github.com/alxmorales2020/api-gateway/router"
+)
+
+func TestHeaderTransform(t *testing.T) {
+	core.RegisterPlugin("jwt-auth", auth.New)
+	core.RegisterPlugin("header-transform", headers.New)
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "nginx")
+		w.Header().Set("X-Powered-By", "PHP")
+		w.Header().Set("X-Upstream-Time", "12ms")
+		json.NewEncoder(w).Encode(r.Header)
+	}))
+	defer upstream.Close()
+
+	rule := func(op, name, value string) map[string]interface{} {
+		return map[string]interface{}{"op": op, "name": name, "value": value, "to": value}
+	}
+	routes := []config.RouteConfig{{
+		ID: "orders", Path: "/orders/{id}", Methods: []string{"GET"}, Upstream: upstream.URL,
+		Plugins: []config.PluginConfig{
+			{Name: "jwt-auth", Config: map[string]interface{}{"secret": "s3cret"}},
+			{Name: "header-transform", Config: map[string]interface{}{
+				"request": []interface{}{
+					rule("remove", "Authorization", ""),
+					rule("set", "X-Internal-Auth", "gw:${route_id}:${param.id}"),
+					rule("add", "X-User", "${claim.sub}"),
+					rule("add", "X-Tenant", "${claim.tenant}"),
+					rule("set", "X-Forwarded-Request", "${request_id}"),
+					rule("rename", "X-Api-Version", "X-Version"),
+				},
+				"response": []interface{}{
+					rule("remove", "Server", ""),
+					rule("remove", "X-Powered-By", ""),
+					rule("rename", "X-Upstream-Time", "X-Backend-Time"),
+					rule("set", "X-Served-For", "${client_ip}"),
+				},
+			}},
+		},
+	}}
+	if err := router.ValidateRoutes(routes); err != nil {
+		t.Fatal(err)
+	}
+	manager, err := router.NewManager(config.NewYAMLRouteStore(routes))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": "alice", "exp": time.Now().Add(time.Minute).Unix(),
+	}).SignedString([]byte("s3cret"))
+	req := httptest.NewRequest(http.MethodGet, "/orders/7", nil)
+	req.RemoteAddr = "203.0.113.9:4711"
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("X-Request-ID", "req-1")
+	req.Header.Set("X-Api-Version", "2")
+	rec := httptest.NewRecorder()
+	manager.ServeHTTP(rec, req)
+
+	var sent http.Header
+	if err := json.Unmarshal(rec.Body.Bytes(), &sent); err != nil {
+		t.Fatalf("%d %s", rec.Code, rec.Body)
+	}
+	want := map[string]string{
+		"Authorization":       "",
+		"X-Internal-Auth":     "gw:orders:7",
+		"X-User":              "alice",
+		"X-Tenant":            "",
+		"X-Forwarded-Request": "req-1",
+		"X-Api-Version":       "",
+		"X-Version":           "2",
+	}
+	for name, value := range want {
+		if got := sent.Get(name); got != value {
+			t.Errorf("upstream got %s %q, want %q", name, got, value)
+		}
+	}
+	got := rec.Header()
+	if got.Get("Server") != "" || got.Get("X-Powered-By") != "" || got.Get("X-Upstream-Time") != "" ||
+		got.Get("X-Backend-Time") != "12ms" || got.Get("X-Served-For") != "203.0.113.9" {
+		t.Errorf("response headers: %v", got)
+	}
+
+	for _, bad := range []map[string]interface{}{
+		{},
+		{"request": []interface{}{rule("set", "X-A", "${nope}")}},
+		{"response": []interface{}{rule("move", "X-A", "")}},
+		{"response": []interface{}{rule("rename", "X-A", "")}},
+	} {
+		if err := headers.New().Init(bad); err == nil {
+			t.Errorf("Init(%v) accepted", bad)
+		}
+	}
+}
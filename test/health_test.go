@@ -0,0 +1,87 @@
+package test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alxmorales2020/api-gateway/config"
+	"github.com/alxmorales2020/api-gateway/proxy"
+)
+
+func TestPassiveHealthCheck(t *testing.T) {
+	good := namedUpstream(t, "good")
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "boom", http.StatusInternalServerError)
+	}))
+	defer bad.Close()
+
+	p, err := proxy.NewReverseProxy(config.RouteConfig{Path: "/passive", Pool: &config.UpstreamPool{
+		Targets: []config.UpstreamTarget{{URL: good.URL}, {URL: bad.URL}},
+		HealthCheck: &config.HealthCheckConfig{
+			Passive: &config.PassiveHealthCheck{UnhealthyThreshold: 2, Cooldown: config.Duration(time.Hour)},
+		},
+	}}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	for i := 0; i < 4; i++ {
+		hit(t, p, nil)
+	}
+	for i := 0; i < 5; i++ {
+		if got := hit(t, p, nil); got != "good" {
+			t.Fatalf("request %d went to the unhealthy target: %q", i, got)
+		}
+	}
+	for _, status := range p.Status() {
+		if status.URL == bad.URL && status.Healthy {
+			t.Error("bad target still reported healthy")
+		}
+	}
+}
+
+func TestActiveHealthCheck(t *testing.T) {
+	good := namedUpstream(t, "good")
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	p, err := proxy.NewReverseProxy(config.RouteConfig{Path: "/active", Pool: &config.UpstreamPool{
+		Targets: []config.UpstreamTarget{{URL: good.URL}, {URL: down.URL}},
+		HealthCheck: &config.HealthCheckConfig{
+			Active: &config.ActiveHealthCheck{
+				Type:               "tcp",
+				Interval:           config.Duration(10 * time.Millisecond),
+				UnhealthyThreshold: 1,
+			},
+		},
+	}}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		healthy := 0
+		for _, status := range p.Status() {
+			if status.Healthy {
+				healthy++
+			}
+		}
+		if healthy == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("down target never marked unhealthy: %+v", p.Status())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	for i := 0; i < 4; i++ {
+		if got := hit(t, p, nil); got != "good" {
+			t.Fatalf("request went to the down target: %q", got)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alxmorales2020/api-gateway/config"
+	"github.com/alxmorales2020/api-gateway/router"
+)
+
+func TestRouteMatchers(t *testing.T) {
+	get := []string{"GET"}
+	routes := []config.RouteConfig{
+		{Path: "/api*", Methods: get, Upstream: namedUpstream(t, "default").URL},
+		{Path: "/api*", Methods: get, Upstream: namedUpstream(t, "tenants").URL,
+			Match: &config.MatchConfig{Hosts: []string{"*.example.com"}}},
+		{Path: "/api*", Methods: get, Upstream: namedUpstream(t, "acme").URL,
+			Match: &config.MatchConfig{Hosts: []string{"acme.example.com"}}},
+		{Path: "/api*", Methods: get, Upstream: namedUpstream(t, "acme-beta").URL,
+			Match: &config.MatchConfig{Hosts: []string{"acme.example.com"}, Headers: []config.ValueMatcher{{Name: "x-beta"}}}},
+		{Path: "/items/{id}", Methods: get, Upstream: namedUpstream(t, "v1").URL},
+		{Path: "/items/{id}", Methods: get, Upstream: namedUpstream(t, "v2").URL,
+			Match: &config.MatchConfig{
+				Headers: []config.ValueMatcher{{Name: "Accept", Regex: `application/vnd\.v2\+json.*`}},
+				Query:   []config.ValueMatcher{{Name: "tenant", Value: "blue"}},
+			}},
+	}
+	if err := router.ValidateRoutes(routes); err != nil {
+		t.Fatalf("routes differing only by match conditions rejected: %v", err)
+	}
+	manager, err := router.NewManager(config.NewYAMLRouteStore(routes))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		method, host, target string
+		header               http.Header
+		want                 string
+	}{
+		{"GET", "gateway.local", "/api/x", nil, "default"},
+		{"GET", "shop.example.com:8080", "/api/x", nil, "tenants"},
+		{"GET", "example.com", "/api/x", nil, "default"},
+		{"GET", "ACME.example.com", "/api/x", nil, "acme"},
+		{"GET", "acme.example.com", "/api/x", http.Header{"X-Beta": {"1"}}, "acme-beta"},
+		{"GET", "gateway.local", "/items/1?tenant=blue", http.Header{"Accept": {"application/vnd.v2+json"}}, "v2"},
+		{"GET", "gateway.local", "/items/1?tenant=red", http.Header{"Accept": {"application/vnd.v2+json"}}, "v1"},
+		{"GET", "gateway.local", "/items/1?tenant=blue", http.Header{"Accept": {"text/html;application/vnd.v2+json"}}, "v1"},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(tc.method, tc.target, nil)
+		req.Host = tc.host
+		for name, values := range tc.header {
+			req.Header[name] = values
+		}
+		rec := httptest.NewRecorder()
+		manager.ServeHTTP(rec, req)
+		if rec.Body.String() != tc.want {
+			t.Errorf("%s %s%s: served by %q (%d), want %q", tc.method, tc.host, tc.target, rec.Body, rec.Code, tc.want)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	manager.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/items/1", nil))
+	if rec.Code != http.StatusMethodNotAllowed || rec.Header().Get("Allow") != "GET" {
+		t.Errorf("DELETE /items/1: %d, Allow %q", rec.Code, rec.Header().Get("Allow"))
+	}
+}
+
+func TestRouteMatcherConflicts(t *testing.T) {
+	upstream := "http://upstream"
+	routes := []config.RouteConfig{
+		{Path: "/a", Methods: []string{"GET"}, Upstream: upstream, Match: &config.MatchConfig{Hosts: []string{"a.test", "b.test"}}},
+		{Path: "/a/", Methods: []string{"GET"}, Upstream: upstream, Match: &config.MatchConfig{Hosts: []string{"b.test", "A.test"}}},
+		{Path: "/u/{id}", Methods: []string{"GET"}, Upstream: upstream},
+		{Path: "/u/{name}", Methods: []string{"POST"}, Upstream: upstream},
+		{Path: "/h", Methods: []string{"GET"}, Upstream: upstream, Match: &config.MatchConfig{
+			Hosts:   []string{"*.*.test"},
+			Headers: []config.ValueMatcher{{Name: "x", Value: "1", Regex: "1"}, {Regex: "("}},
+		}},
+	}
+	want := map[string]bool{
+		"routes[1].path":                   true, // same conditions in another order
+		"routes[3].path":                   true, // parameter names differ
+		"routes[4].match.hosts[0]":         true,
+		"routes[4].match.headers[0]":       true,
+		"routes[4].match.headers[1].name":  true,
+		"routes[4].match.headers[1].regex": true,
+	}
+	err := router.ValidateRoutes(routes)
+	invalid, ok := err.(*router.ValidationError)
+	if !ok {
+		t.Fatalf("ValidateRoutes = %v", err)
+	}
+	for _, fe := range invalid.Errors {
+		if !want[fe.Field] {
+			t.Errorf("unexpected error %s: %s", fe.Field, fe.Message)
+		}
+		delete(want, fe.Field)
+	}
+	for field := range want {
+		t.Errorf("no error for %s", field)
+	}
+}
@@ -0,0 +1,103 @@
+package test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alxmorales2020/api-gateway/core"
+)
+
+type phasePlugin struct {
+	calls  []string
+	status int
+}
+
+func (p *phasePlugin) Name() string                      { return "phases" }
+func (p *phasePlugin) Init(map[string]interface{}) error { return nil }
+func (p *phasePlugin) Execute(http.ResponseWriter, *http.Request) error {
+	p.calls = append(p.calls, "access")
+	return nil
+}
+func (p *phasePlugin) Rewrite(w http.ResponseWriter, r *http.Request) error {
+	p.calls = append(p.calls, "rewrite")
+	r.Header.Set("X-Rewritten", "1")
+	return nil
+}
+func (p *phasePlugin) HeaderFilter(rc *core.RequestContext) error {
+	p.calls = append(p.calls, "header")
+	rc.Response.Header().Del("Server")
+	return nil
+}
+func (p *phasePlugin) BodyFilter(rc *core.RequestContext, body []byte) ([]byte, error) {
+	p.calls = append(p.calls, "body")
+	return bytes.ToUpper(body), nil
+}
+func (p *phasePlugin) Log(rc *core.RequestContext) {
+	p.calls = append(p.calls, "log")
+	p.status = rc.Response.StatusCode
+}
+
+func TestPipelinePhases(t *testing.T) {
+	plugin := &phasePlugin{}
+	pipeline := core.NewPipeline(core.RouteInfo{Path: "/"}, []core.Plugin{plugin})
+	upstream := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		plugin.calls = append(plugin.calls, "upstream")
+		if r.Header.Get("X-Rewritten") != "1" {
+			t.Error("rewrite phase did not run before upstream")
+		}
+		w.Header().Set("Server", "legacy")
+		w.Header().Set("Content-Length", "5")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte("hello"))
+	})
+
+	rec := httptest.NewRecorder()
+	pipeline.Serve(rec, httptest.NewRequest(http.MethodGet, "/", nil), nil, upstream)
+
+	want := []string{"rewrite", "access", "upstream", "header", "body", "log"}
+	if len(plugin.calls) != len(want) {
+		t.Fatalf("phases = %v, want %v", plugin.calls, want)
+	}
+	for i := range want {
+		if plugin.calls[i] != want[i] {
+			t.Fatalf("phases = %v, want %v", plugin.calls, want)
+		}
+	}
+	if rec.Code != http.StatusCreated || rec.Body.String() != "HELLO" {
+		t.Errorf("got %d %q", rec.Code, rec.Body.String())
+	}
+	if rec.Header().Get("Server") != "" {
+		t.Error("header filter change not applied")
+	}
+	if plugin.status != http.StatusCreated {
+		t.Errorf("log phase saw status %d", plugin.status)
+	}
+}
+
+func TestBodyFilterBufferLimit(t *testing.T) {
+	for _, c := range []struct {
+		name   string
+		writes []string
+		want   string
+	}{
+		{"within the limit", []string{"ab", "cd"}, "ABCD"},
+		{"over the limit", []string{"ab", "cd", "ef"}, "abcdef"},
+	} {
+		rec := httptest.NewRecorder()
+		rr := core.NewResponseRecorder(rec)
+		rr.BodyFilter = func(body []byte) ([]byte, error) { return bytes.ToUpper(body), nil }
+		rr.MaxBuffer = 4
+		for _, w := range c.writes {
+			_, _ = rr.Write([]byte(w))
+		}
+		rr.Finish()
+		if rec.Body.String() != c.want {
+			t.Errorf("%s: body %q, want %q", c.name, rec.Body.String(), c.want)
+		}
+		if rr.Bytes != len(c.want) {
+			t.Errorf("%s: %d bytes counted, want %d", c.name, rr.Bytes, len(c.want))
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alxmorales2020/api-gateway/config"
+	"github.com/alxmorales2020/api-gateway/router"
+)
+
+func TestPrefixRoutes(t *testing.T) {
+	get := []string{"GET"}
+	routes := []config.RouteConfig{
+		{Path: "/api*", Methods: get, Upstream: namedUpstream(t, "api").URL},
+		{Path: "/api/v2*", Methods: []string{"GET", "POST"}, Upstream: namedUpstream(t, "v2").URL},
+		{Path: "/api/v2/admin*", Methods: get, Upstream: namedUpstream(t, "admin").URL},
+		{Path: "/api/v2/legacy*", Methods: get, Upstream: namedUpstream(t, "legacy").URL, Priority: -1},
+		{Path: "/api/status", Methods: get, Upstream: namedUpstream(t, "status").URL},
+		{Path: "/files*", Methods: get, Upstream: namedUpstream(t, "files").URL},
+		{Path: "/files/{bucket}*", Methods: get, Upstream: namedUpstream(t, "bucket").URL, Priority: -1},
+	}
+	if err := router.ValidateRoutes(routes); err != nil {
+		t.Fatalf("overlapping prefixes rejected: %v", err)
+	}
+	manager, err := router.NewManager(config.NewYAMLRouteStore(routes))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		method, target string
+		want           string
+	}{
+		{"GET", "/api/users", "api"},
+		{"GET", "/api/v2/users", "v2"},
+		{"POST", "/api/v2/users", "v2"},
+		{"GET", "/api/v2/admin/x", "admin"},
+		{"POST", "/api/v2/admin/x", "v2"},    // admin only takes GET
+		{"GET", "/api/v2/legacy/x", "v2"},    // lower priority loses to the shorter prefix
+		{"GET", "/api/status", "status"},     // exact routes come first
+		{"GET", "/files/b1/readme", "files"}, // priority beats length
+	}
+	for _, tc := range cases {
+		rec := httptest.NewRecorder()
+		manager.ServeHTTP(rec, httptest.NewRequest(tc.method, tc.target, nil))
+		if rec.Body.String() != tc.want {
+			t.Errorf("%s %s: served by %q (%d), want %q", tc.method, tc.target, rec.Body, rec.Code, tc.want)
+		}
+	}
+
+	for target, allow := range map[string]string{"/api/users": "GET", "/api/v2/admin/x": "GET, POST", "/api/status": "GET"} {
+		rec := httptest.NewRecorder()
+		manager.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, target, nil))
+		if rec.Code != http.StatusMethodNotAllowed || rec.Header().Get("Allow") != allow {
+			t.Errorf("DELETE %s: %d, Allow %q, want 405 with %q", target, rec.Code, rec.Header().Get("Allow"), allow)
+		}
+	}
+	if code := statusOf(manager, "/nothing"); code != http.StatusNotFound {
+		t.Errorf("/nothing: %d", code)
+	}
+}
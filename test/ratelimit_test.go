@@ -0,0 +1,197 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alxmorales2020/api-gateway/core"
+	"github.com/alxmorales2020/api-gateway/plugins/ratelimit"
+)
+
+func newRateLimit(t *testing.T, cfg map[string]interface{}) core.Plugin {
+	t.Helper()
+	plugin := ratelimit.New()
+	if err := plugin.Init(cfg); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+	return plugin
+}
+
+func limitRequest(plugin core.Plugin, route, remoteAddr string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = remoteAddr
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	rec := httptest.NewRecorder()
+	req = core.WithRequestContext(req, &core.RequestContext{Writer: rec, Route: core.RouteInfo{ID: route}})
+	if plugin.Execute(rec, req) == nil {
+		rec.WriteHeader(http.StatusOK)
+	}
+	return rec
+}
+
+func TestRateLimitAlgorithms(t *testing.T) {
+	for _, algorithm := range []string{"token-bucket", "sliding-window"} {
+		t.Run(algorithm, func(t *testing.T) {
+			plugin := newRateLimit(t, map[string]interface{}{"algorithm": algorithm, "limit": 2, "window": "1m"})
+			route := "algo-" + algorithm
+
+			for i, want := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+				rec := limitRequest(plugin, route, "10.0.0.1:1000", nil)
+				if rec.Code != want {
+					t.Fatalf("request %d: status %d, want %d", i+1, rec.Code, want)
+				}
+				if rec.Header().Get("RateLimit-Limit") != "2" {
+					t.Errorf("RateLimit-Limit = %q", rec.Header().Get("RateLimit-Limit"))
+				}
+			}
+			rec := limitRequest(plugin, route, "10.0.0.1:1000", nil)
+			if rec.Header().Get("RateLimit-Remaining") != "0" || rec.Header().Get("Retry-After") == "" {
+				t.Errorf("429 headers = %v", rec.Header())
+			}
+
+			// Other clients have their own quota.
+			if rec := limitRequest(plugin, route, "10.0.0.2:1000", nil); rec.Code != http.StatusOK {
+				t.Errorf("second client: status %d", rec.Code)
+			}
+		})
+	}
+}
+
+func TestRateLimitHeaderKeyFallsBackToIP(t *testing.T) {
+	plugin := newRateLimit(t, map[string]interface{}{"limit": 1, "window": "1m", "key": "header", "key_name": "X-Api-Key"})
+	route := "header-key"
+
+	a := http.Header{"X-Api-Key": {"a"}}
+	b := http.Header{"X-Api-Key": {"b"}}
+	if limitRequest(plugin, route, "10.0.0.1:1", a).Code != http.StatusOK ||
+		limitRequest(plugin, route, "10.0.0.1:1", b).Code != http.StatusOK {
+		t.Fatal("different keys from one IP should not share a quota")
+	}
+	if limitRequest(plugin, route, "10.0.0.2:1", a).Code != http.StatusTooManyRequests {
+		t.Error("same key from another IP should share the quota")
+	}
+	if limitRequest(plugin, route, "10.0.0.3:1", nil).Code != http.StatusOK ||
+		limitRequest(plugin, route, "10.0.0.3:1", nil).Code != http.StatusTooManyRequests {
+		t.Error("requests without the header should be limited by IP")
+	}
+}
+
+func TestRateLimitSurvivesReload(t *testing.T) {
+	cfg := map[string]interface{}{"limit": 1, "window": "1m", "key": "route"}
+	route := "reloaded"
+	if rec := limitRequest(newRateLimit(t, cfg), route, "10.0.0.1:1", nil); rec.Code != http.StatusOK {
+		t.Fatalf("status %d", rec.Code)
+	}
+	// A new plugin instance, as built by a router reload, keeps the counters.
+	if rec := limitRequest(newRateLimit(t, cfg), route, "10.0.0.2:1", nil); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("after reload: status %d, want 429", rec.Code)
+	}
+	// Other routes are counted separately.
+	if rec := limitRequest(newRateLimit(t, cfg), "other", "10.0.0.1:1", nil); rec.Code != http.StatusOK {
+		t.Errorf("other route: status %d", rec.Code)
+	}
+}
+
+func TestRateLimitInvalidConfig(t *testing.T) {
+	for _, cfg := range []map[string]interface{}{
+		{},
+		{"limit": 1, "algorithm": "leaky"},
+		{"limit": 1, "key": "claim"},
+		{"limit": 1, "key": "cookie"},
+	} {
+		if err := ratelimit.New().Init(cfg); err == nil {
+			t.Errorf("Init(%v) succeeded, want error", cfg)
+		}
+	}
+}
+
+// fakeBackend adds others to every counter, as if other replicas had
+// already counted that many requests.
+type fakeBackend struct {
+	mu     sync.Mutex
+	others int64
+	counts map[string]int64
+	err    error
+}
+
+func (b *fakeBackend) Increment(_ context.Context, key string, n int64, _ time.Time) (int64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.err != nil {
+		return 0, b.err
+	}
+	if b.counts == nil {
+		b.counts = map[string]int64{}
+	}
+	b.counts[key] += n
+	return b.counts[key] + b.others, nil
+}
+
+func newClusterRateLimit(t *testing.T, backend ratelimit.Backend, limit int) core.Plugin {
+	t.Helper()
+	ratelimit.SetBackend(backend)
+	t.Cleanup(func() { ratelimit.SetBackend(nil) })
+	return newRateLimit(t, map[string]interface{}{
+		"limit": limit, "window": "1m", "key": "route", "scope": "cluster", "sync_interval": "10ms",
+	})
+}
+
+func TestRateLimitClusterSharesCounts(t *testing.T) {
+	backend := &fakeBackend{others: 10}
+	plugin := newClusterRateLimit(t, backend, 5)
+
+	if rec := limitRequest(plugin, "cluster-shared", "10.0.0.1:1", nil); rec.Code != http.StatusOK {
+		t.Fatalf("first request: status %d", rec.Code)
+	}
+	time.Sleep(200 * time.Millisecond) // let the batch reach the backend
+
+	if rec := limitRequest(plugin, "cluster-shared", "10.0.0.1:1", nil); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("with other replicas over the limit: status %d, want 429", rec.Code)
+	}
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+	if len(backend.counts) != 1 {
+		t.Errorf("backend counters = %v", backend.counts)
+	}
+}
+
+func TestRateLimitClusterFallsBackToLocal(t *testing.T) {
+	plugin := newClusterRateLimit(t, &fakeBackend{err: errors.New("unreachable")}, 2)
+
+	for i, want := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		if rec := limitRequest(plugin, "cluster-down", "10.0.0.1:1", nil); rec.Code != want {
+			t.Fatalf("request %d: status %d, want %d", i+1, rec.Code, want)
+		}
+	}
+	time.Sleep(200 * time.Millisecond) // failed sync must keep the local counts
+	if rec := limitRequest(plugin, "cluster-down", "10.0.0.1:1", nil); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("after failed sync: status %d, want 429", rec.Code)
+	}
+}
+
+func TestRateLimitClusterWithoutBackendWarnsOnce(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	cfg := map[string]interface{}{"limit": 10, "window": "1m", "scope": "cluster"}
+	// Every router reload initializes the plugin again.
+	for i := 0; i < 3; i++ {
+		plugin := newRateLimit(t, cfg)
+		limitRequest(plugin, "cluster-local", "10.0.0.1:1", nil)
+	}
+	if n := strings.Count(logs.String(), "without a shared backend"); n != 1 {
+		t.Fatalf("warning logged %d times, want 1:\n%s", n, logs.String())
+	}
+}
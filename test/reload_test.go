@@ -0,0 +1,155 @@
+package test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alxmorales2020/api-gateway/admin"
+	"github.com/alxmorales2020/api-gateway/config"
+	"github.com/alxmorales2020/api-gateway/core"
+	"github.com/alxmorales2020/api-gateway/router"
+)
+
+type reloadReport struct {
+	Reloaded bool                 `json:"reloaded"`
+	Errors   []router.FieldError  `json:"errors"`
+	Added    []config.RouteConfig `json:"added"`
+	Removed  []config.RouteConfig `json:"removed"`
+	Changed  []struct {
+		ID   string               `json:"id"`
+		Diff []config.FieldChange `json:"diff"`
+	} `json:"changed"`
+	Unchanged int `json:"unchanged"`
+}
+
+func TestAdminReloadDryRun(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer upstream.Close()
+
+	store := config.NewYAMLRouteStore([]config.RouteConfig{
+		{ID: "keep", Path: "/keep", Methods: []string{"GET"}, Upstream: upstream.URL},
+		{ID: "edit", Path: "/edit", Methods: []string{"GET"}, Upstream: upstream.URL},
+		{ID: "gone", Path: "/gone", Methods: []string{"GET"}, Upstream: upstream.URL},
+	})
+	manager, err := router.NewManager(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := admin.NewAdminHandler(store, manager).Routes()
+
+	// Change the store behind the router's back.
+	_ = store.UpdateRoute(&config.RouteConfig{ID: "edit", Path: "/edit", Methods: []string{"GET", "POST"}, Upstream: upstream.URL}, config.AnyRevision)
+	_ = store.DeleteRoute("gone", config.AnyRevision)
+	_ = store.SaveRoute(&config.RouteConfig{ID: "new", Path: "/new", Methods: []string{"GET"}, Upstream: upstream.URL})
+
+	rec := adminRequest(h, http.MethodPost, "/reload?dry_run=true", "", "")
+	var report reloadReport
+	if rec.Code != http.StatusOK || json.Unmarshal(rec.Body.Bytes(), &report) != nil {
+		t.Fatalf("dry run: %d %s", rec.Code, rec.Body)
+	}
+	if report.Reloaded || len(report.Added) != 1 || report.Added[0].ID != "new" ||
+		len(report.Removed) != 1 || report.Removed[0].ID != "gone" ||
+		len(report.Changed) != 1 || report.Changed[0].Diff[0].Field != "methods" || report.Unchanged != 1 {
+		t.Errorf("dry run report: %s", rec.Body)
+	}
+	if code := statusOf(manager, "/new"); code != http.StatusNotFound {
+		t.Errorf("dry run swapped the router: /new answered %d", code)
+	}
+
+	// A candidate that fails to build is reported and never swapped in.
+	_ = store.SaveRoute(&config.RouteConfig{ID: "bad", Path: "/bad/{id", Methods: []string{"GET"}, Upstream: upstream.URL})
+	rec = adminRequest(h, http.MethodPost, "/reload", "", "")
+	report = reloadReport{}
+	_ = json.Unmarshal(rec.Body.Bytes(), &report)
+	if rec.Code != http.StatusUnprocessableEntity || report.Reloaded || len(report.Errors) != 1 {
+		t.Errorf("reload with invalid route: %d %s", rec.Code, rec.Body)
+	}
+	if code := statusOf(manager, "/gone"); code != http.StatusOK {
+		t.Errorf("serving routes changed after failed reload: /gone answered %d", code)
+	}
+
+	_ = store.DeleteRoute("bad", config.AnyRevision)
+	rec = adminRequest(h, http.MethodPost, "/reload", "", "")
+	report = reloadReport{}
+	_ = json.Unmarshal(rec.Body.Bytes(), &report)
+	if rec.Code != http.StatusOK || !report.Reloaded {
+		t.Fatalf("reload: %d %s", rec.Code, rec.Body)
+	}
+	if code := statusOf(manager, "/new"); code != http.StatusOK {
+		t.Errorf("/new after reload: %d", code)
+	}
+}
+
+func TestDryRunLeavesUpstreamsAlone(t *testing.T) {
+	var probes atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/healthz" {
+			probes.Add(1)
+		}
+	}))
+	defer upstream.Close()
+
+	store := config.NewYAMLRouteStore(nil)
+	manager, err := router.NewManager(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = store.SaveRoute(&config.RouteConfig{ID: "checked", Path: "/checked", Methods: []string{"GET"}, Pool: &config.UpstreamPool{
+		Targets: []config.UpstreamTarget{{URL: upstream.URL}},
+		HealthCheck: &config.HealthCheckConfig{
+			Active: &config.ActiveHealthCheck{Path: "/healthz", Interval: config.Duration(5 * time.Millisecond)},
+		},
+	}})
+
+	check, err := manager.DryRun()
+	if err != nil || check.Err != nil {
+		t.Fatalf("dry run: %v %v", err, check.Err)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if n := probes.Load(); n != 0 {
+		t.Errorf("dry run sent %d health probe(s)", n)
+	}
+
+	if err := manager.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for probes.Load() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("reloaded route never probed its upstream")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// countingPlugin counts Init calls.
+type countingPlugin struct{ inits *atomic.Int32 }
+
+func (countingPlugin) Name() string                                     { return "counting" }
+func (p countingPlugin) Init(map[string]interface{}) error              { p.inits.Add(1); return nil }
+func (countingPlugin) Execute(http.ResponseWriter, *http.Request) error { return nil }
+
+func TestBuildInitializesPluginsOnce(t *testing.T) {
+	var inits atomic.Int32
+	core.RegisterPlugin("counting", func() core.Plugin { return countingPlugin{&inits} })
+
+	store := config.NewYAMLRouteStore([]config.RouteConfig{{ID: "counted", Path: "/counted", Methods: []string{"GET"}, Upstream: "http://counted",
+		Plugins: []config.PluginConfig{{Name: "counting"}}}})
+	manager, err := router.NewManager(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := inits.Load(); n != 1 {
+		t.Errorf("building the router initialized the plugin %d times, want 1", n)
+	}
+	if _, err := manager.DryRun(); err != nil {
+		t.Fatal(err)
+	}
+	if n := inits.Load(); n != 2 {
+		t.Errorf("after a dry run the plugin was initialized %d times, want 2", n)
+	}
+}
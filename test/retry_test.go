@@ -0,0 +1,59 @@
+package test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/alxmorales2020/api-gateway/config"
+	"github.com/alxmorales2020/api-gateway/proxy"
+)
+
+func TestRetryMovesToAnotherTarget(t *testing.T) {
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	unavailable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "busy", http.StatusServiceUnavailable)
+	}))
+	defer unavailable.Close()
+	echo := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		_, _ = w.Write(append([]byte("ok:"), body...))
+	}))
+	defer echo.Close()
+
+	p, err := proxy.NewReverseProxy(config.RouteConfig{
+		Path: "/retry",
+		Pool: &config.UpstreamPool{Targets: []config.UpstreamTarget{
+			{URL: down.URL}, {URL: unavailable.URL}, {URL: echo.URL},
+		}},
+		Retry: &config.RetryConfig{Attempts: 3},
+	}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	for i := 0; i < 6; i++ {
+		rec := httptest.NewRecorder()
+		p.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/", strings.NewReader("payload")))
+		if rec.Code != http.StatusOK || rec.Body.String() != "ok:payload" {
+			t.Fatalf("request %d: got %d %q", i, rec.Code, rec.Body.String())
+		}
+	}
+
+	// POST is not in the default retry methods, so failures reach the client.
+	failures := 0
+	for i := 0; i < 3; i++ {
+		rec := httptest.NewRecorder()
+		p.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", strings.NewReader("x")))
+		if rec.Code != http.StatusOK {
+			failures++
+		}
+	}
+	if failures != 2 {
+		t.Errorf("POST failures = %d, want 2", failures)
+	}
+}
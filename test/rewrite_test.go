@@ -0,0 +1,67 @@
+package test
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alxmorales2020/api-gateway/config"
+	"github.com/alxmorales2020/api-gateway/router"
+)
+
+func TestRewriteRoutes(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.URL.RequestURI())
+	}))
+	defer upstream.Close()
+
+	get := []string{"GET"}
+	routes := []config.RouteConfig{
+		{Path: "/users/{id}/orders", Methods: get, Upstream: upstream.URL,
+			Rewrite: &config.RewriteConfig{Path: "/v2/orders?user={id}"}},
+		{Path: "/profiles/{id}", Methods: get, Upstream: upstream.URL,
+			Rewrite: &config.RewriteConfig{Path: "/v2/users/{id}/profile"}},
+		{Path: "/shop/{tenant}/*", Methods: get, Upstream: upstream.URL + "/base", StripPrefix: true,
+			Rewrite: &config.RewriteConfig{
+				Regex:    []config.RegexRewrite{{Match: `^/shop/[^/]+/items/(\d+)$`, Replace: "/items/$1/detail"}, {Match: `/detail$`, Replace: "/full"}},
+				BasePath: "/api",
+			}},
+		{Path: "/legacy*", Methods: get, Upstream: upstream.URL, StripPrefix: true,
+			Rewrite: &config.RewriteConfig{BasePath: "/v1"}},
+	}
+	if err := router.ValidateRoutes(routes); err != nil {
+		t.Fatal(err)
+	}
+	manager, err := router.NewManager(config.NewYAMLRouteStore(routes))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]string{
+		"/users/42/orders?limit=5":                 "/v2/orders?user=42&limit=5",
+		"/users/a%26b/orders":                      "/v2/orders?user=a%26b",
+		"/profiles/..%2F..%2Fadmin%2Fsecrets%3Fx=": "/v2/users/..%2F..%2Fadmin%2Fsecrets%3Fx=/profile",
+		"/profiles/..":                             "/v2/users/%2E%2E/profile",
+		"/profiles/a%2541":                         "/v2/users/a%2541/profile", // a literal %41 is not decoded twice
+		"/users/a%2541/orders":                     "/v2/orders?user=a%2541",
+		"/shop/acme/items/7":                       "/base/api/items/7/full", // strip_prefix does not apply to a parameterized prefix
+		"/legacy/reports?x=1":                      "/v1/reports?x=1",
+		"/legacy":                                  "/v1/",
+	}
+	for target, want := range cases {
+		rec := httptest.NewRecorder()
+		manager.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+		if rec.Body.String() != want {
+			t.Errorf("%s forwarded as %q (%d), want %q", target, rec.Body, rec.Code, want)
+		}
+	}
+
+	invalid := []config.RouteConfig{{Path: "/users/{id}", Methods: get, Upstream: upstream.URL,
+		Rewrite: &config.RewriteConfig{Path: "/v2/{user}", Regex: []config.RegexRewrite{{Match: "("}}, BasePath: "v1"}}}
+	var verr *router.ValidationError
+	if err := router.ValidateRoutes(invalid); !errors.As(err, &verr) || len(verr.Errors) != 3 {
+		t.Errorf("invalid rewrite: %v", err)
+	}
+}
@@ -0,0 +1,69 @@
+package test
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alxmorales2020/api-gateway/config"
+	"github.com/alxmorales2020/api-gateway/proxy"
+)
+
+func TestRouteTimeouts(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer slow.Close()
+
+	// Accepts connections but never answers the TLS handshake.
+	silent, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer silent.Close()
+	go func() {
+		for {
+			conn, err := silent.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	for _, tc := range []struct {
+		name     string
+		upstream string
+		timeouts *config.TimeoutConfig
+	}{
+		{"response header timeout", slow.URL, &config.TimeoutConfig{ResponseHeader: config.Duration(20 * time.Millisecond)}},
+		{"request deadline exceeded", slow.URL, &config.TimeoutConfig{Request: config.Duration(20 * time.Millisecond)}},
+		{"request deadline exceeded", slow.URL, &config.TimeoutConfig{
+			Request:        config.Duration(20 * time.Millisecond),
+			ResponseHeader: config.Duration(time.Second),
+		}},
+		{"TLS handshake timeout", "https://" + silent.Addr().String(), &config.TimeoutConfig{TLSHandshake: config.Duration(20 * time.Millisecond)}},
+	} {
+		name, timeouts := tc.name, tc.timeouts
+		p, err := proxy.NewReverseProxy(config.RouteConfig{Path: "/slow", Upstream: tc.upstream, Timeouts: timeouts}, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		rec := httptest.NewRecorder()
+		p.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		p.Close()
+
+		if rec.Code != http.StatusGatewayTimeout || !strings.Contains(rec.Body.String(), name) {
+			t.Errorf("%s: got %d %q", name, rec.Code, rec.Body.String())
+		}
+		if rec.Header().Get("X-Gateway-Error") != "upstream-timeout" {
+			t.Errorf("%s: missing X-Gateway-Error header", name)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/alxmorales2020/api-gateway/admin"
+	"github.com/alxmorales2020/api-gateway/config"
+	"github.com/alxmorales2020/api-gateway/core"
+	"github.com/alxmorales2020/api-gateway/plugins/ratelimit"
+	"github.com/alxmorales2020/api-gateway/router"
+)
+
+func TestValidateRoutes(t *testing.T) {
+	core.RegisterPlugin("rate-limit", ratelimit.New)
+	valid := config.RouteConfig{Path: "/users/{id}", Methods: []string{"GET"}, Upstream: "http://users"}
+
+	cases := []struct {
+		name   string
+		routes []config.RouteConfig
+		want   []string // fields with errors
+	}{
+		{"valid", []config.RouteConfig{valid, {Path: "/api*", Methods: []string{"get", "POST"}, Upstream: "https://api:8443"}}, nil},
+		{"upstream scheme", []config.RouteConfig{{Path: "/a", Methods: []string{"GET"}, Upstream: "ftp://a"}}, []string{"routes[0].upstream"}},
+		{"upstream without host", []config.RouteConfig{{Path: "/a", Methods: []string{"GET"}, Upstream: "http://"}}, []string{"routes[0].upstream"}},
+		{"pool target", []config.RouteConfig{{Path: "/a", Methods: []string{"GET"}, Pool: &config.UpstreamPool{Targets: []config.UpstreamTarget{{URL: "http://a"}, {URL: "a:80"}}}}}, []string{"routes[0].upstream_pool.targets[1].url"}},
+		{"negative weight", []config.RouteConfig{{Path: "/a", Methods: []string{"GET"}, Pool: &config.UpstreamPool{Targets: []config.UpstreamTarget{{URL: "http://a", Weight: weight(-1)}, {URL: "http://b"}}}}}, []string{"routes[0].upstream_pool.targets[0].weight"}},
+		{"drained target", []config.RouteConfig{{Path: "/a", Methods: []string{"GET"}, Pool: &config.UpstreamPool{Targets: []config.UpstreamTarget{{URL: "http://a", Weight: weight(0)}, {URL: "http://b"}}}}}, nil},
+		{"every target drained", []config.RouteConfig{{Path: "/a", Methods: []string{"GET"}, Pool: &config.UpstreamPool{Targets: []config.UpstreamTarget{{URL: "http://a", Weight: weight(0)}}}}}, []string{"routes[0].upstream_pool.targets"}},
+		{"method", []config.RouteConfig{{Path: "/a", Methods: []string{"GET", "FETCH"}, Upstream: "http://a"}}, []string{"routes[0].methods[1]"}},
+		{"no methods", []config.RouteConfig{{Path: "/a", Upstream: "http://a"}}, []string{"routes[0].methods"}},
+		{"wildcard", []config.RouteConfig{{Path: "/a*/b", Methods: []string{"GET"}, Upstream: "http://a"}}, []string{"routes[0].path"}},
+		{"param", []config.RouteConfig{{Path: "/a/{id", Methods: []string{"GET"}, Upstream: "http://a"}}, []string{"routes[0].path"}},
+		{"duplicate param", []config.RouteConfig{{Path: "/a/{id}/{id}", Methods: []string{"GET"}, Upstream: "http://a"}}, []string{"routes[0].path"}},
+		{"unknown plugin", []config.RouteConfig{{Path: "/a", Methods: []string{"GET"}, Upstream: "http://a", Plugins: []config.PluginConfig{{Name: "nope"}}}}, []string{"routes[0].plugins[0].name"}},
+		{"plugin config", []config.RouteConfig{{Path: "/a", Methods: []string{"GET"}, Upstream: "http://a", Plugins: []config.PluginConfig{{Name: "rate-limit", Config: map[string]interface{}{"limit": 0}}}}}, []string{"routes[0].plugins[0].config"}},
+		{"same method and path", []config.RouteConfig{valid, {Path: "/users/{name}/", Methods: []string{"POST", "GET"}, Upstream: "http://b"}}, []string{"routes[1].path"}},
+		{"same prefix", []config.RouteConfig{{Path: "/api*", Methods: []string{"GET"}, Upstream: "http://a"}, {Path: "/api/*", Methods: []string{"POST", "GET"}, Upstream: "http://b"}}, []string{"routes[1].path"}},
+		{"regexp param with quantifier", []config.RouteConfig{{Path: "/codes/{id:[0-9]{3}-[0-9]{2}}", Methods: []string{"GET"}, Upstream: "http://a",
+			Rewrite: &config.RewriteConfig{Path: "/v2/codes/{id}"}}}, nil},
+		{"same path, regexp params with quantifiers", []config.RouteConfig{
+			{Path: "/codes/{id:[0-9]{3}-[0-9]{2}}", Methods: []string{"GET"}, Upstream: "http://a"},
+			{Path: "/codes/{code:[a-z]{3}}", Methods: []string{"GET"}, Upstream: "http://b"}}, []string{"routes[1].path"}},
+		{"same prefix, other methods", []config.RouteConfig{{Path: "/api*", Methods: []string{"GET"}, Upstream: "http://a"}, {Path: "/api/*", Methods: []string{"POST"}, Upstream: "http://b"}}, nil},
+	}
+	for _, tc := range cases {
+		err := router.ValidateRoutes(tc.routes)
+		var got []string
+		var invalid *router.ValidationError
+		if errors.As(err, &invalid) {
+			for _, fe := range invalid.Errors {
+				got = append(got, fe.Field)
+			}
+		} else if err != nil {
+			t.Errorf("%s: unexpected error type %T", tc.name, err)
+		}
+		if strings.Join(got, ",") != strings.Join(tc.want, ",") {
+			t.Errorf("%s: errors on %v, want %v (%v)", tc.name, got, tc.want, err)
+		}
+	}
+}
+
+func TestAdminRejectsInvalidRoute(t *testing.T) {
+	store := config.NewYAMLRouteStore([]config.RouteConfig{{ID: "r1", Path: "/a", Methods: []string{"GET"}, Upstream: "http://a"}})
+	runtime := &fakeRuntime{}
+	h := admin.NewAdminHandler(store, runtime).Routes()
+
+	rec := adminRequest(h, http.MethodPost, "/routes", "application/json",
+		`{"path": "/a", "methods": ["GET", "BREW"], "upstream": "mailto:x"}`)
+	if rec.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("POST invalid route: %d %s", rec.Code, rec.Body)
+	}
+	var body struct {
+		Errors []router.FieldError `json:"errors"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	fields := map[string]bool{}
+	for _, fe := range body.Errors {
+		fields[fe.Field] = true
+	}
+	for _, field := range []string{"methods[1]", "upstream", "path"} {
+		if !fields[field] {
+			t.Errorf("no error for %s in %s", field, rec.Body)
+		}
+	}
+	if routes, _ := store.LoadRoutes(); len(routes) != 1 || runtime.reloads != 0 {
+		t.Errorf("invalid route was stored: %d routes, %d reloads", len(routes), runtime.reloads)
+	}
+
+	// A route does not conflict with its own stored version.
+	rec = adminRequest(h, http.MethodPut, "/routes/r1", "application/json",
+		`{"path": "/a", "methods": ["GET"], "upstream": "http://b"}`)
+	if rec.Code != http.StatusOK {
+		t.Errorf("PUT same path: %d %s", rec.Code, rec.Body)
+	}
+}
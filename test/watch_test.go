@@ -0,0 +1,105 @@
+package test
+
+import (
+	"context"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alxmorales2020/api-gateway/config"
+	"github.com/alxmorales2020/api-gateway/router"
+)
+
+// watchedStore counts loads and lets the test trigger change notifications.
+type watchedStore struct {
+	*config.YAMLRouteStore
+	loads    int32
+	onChange chan func()
+}
+
+func (s *watchedStore) LoadRoutes() ([]config.RouteConfig, error) {
+	atomic.AddInt32(&s.loads, 1)
+	return s.YAMLRouteStore.LoadRoutes()
+}
+
+func (s *watchedStore) Watch(ctx context.Context, onChange func()) error {
+	s.onChange <- onChange
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestManagerWatchDebouncesReloads(t *testing.T) {
+	store := &watchedStore{YAMLRouteStore: config.NewYAMLRouteStore(nil), onChange: make(chan func(), 1)}
+	manager, err := router.NewManager(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if !manager.Watch(ctx, 50*time.Millisecond) {
+		t.Fatal("store implementing RouteWatcher was not watched")
+	}
+	onChange := <-store.onChange
+
+	for i := 0; i < 5; i++ {
+		onChange()
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(200 * time.Millisecond)
+	if loads := atomic.LoadInt32(&store.loads); loads != 2 {
+		t.Errorf("loads = %d, want 2 (initial and one debounced reload)", loads)
+	}
+
+	if yamlManager, _ := router.NewManager(config.NewYAMLRouteStore(nil)); yamlManager.Watch(ctx, 0) {
+		t.Error("YAML store should not be watchable")
+	}
+}
+
+// TestMongoWatch needs a MongoDB replica set, e.g.
+//
+//	mongod --replSet rs0 --dbpath /tmp/db && mongosh --eval 'rs.initiate()'
+//	GATEWAY_TEST_MONGO_URI=mongodb://localhost:27017/?replicaSet=rs0 go test ./test/ -run MongoWatch
+func TestMongoWatch(t *testing.T) {
+	uri := os.Getenv("GATEWAY_TEST_MONGO_URI")
+	if uri == "" {
+		t.Skip("GATEWAY_TEST_MONGO_URI not set")
+	}
+	store, err := config.NewMongoRouteStore(&config.MongoDBConfig{URI: uri, Database: "gateway_test", Collection: "routes_watch"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	changes := 0
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go store.(config.RouteWatcher).Watch(ctx, func() {
+		mu.Lock()
+		changes++
+		mu.Unlock()
+	})
+	time.Sleep(time.Second)
+
+	mu.Lock()
+	before := changes
+	mu.Unlock()
+	route := &config.RouteConfig{Path: "/watched", Methods: []string{"GET"}, Upstream: "http://watched"}
+	if err := store.SaveRoute(route); err != nil {
+		t.Fatal(err)
+	}
+	defer store.DeleteRoute(route.ID, config.AnyRevision)
+
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		mu.Lock()
+		n := changes
+		mu.Unlock()
+		if n > before {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Error("no change reported for an inserted route")
+}
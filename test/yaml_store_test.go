@@ -0,0 +1,138 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alxmorales2020/api-gateway/config"
+)
+
+func TestYAMLFileRouteStoreWritesBack(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	original := `# gateway settings
+server:
+  address: ":9090" # keep me
+routes:
+  - path: /a
+    methods: [GET]
+    upstream: http://a
+    plugins:
+      - logging
+`
+	if err := os.WriteFile(path, []byte(original), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := config.LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := config.NewYAMLFileRouteStore(path, cfg.Routes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	routes, _ := store.LoadRoutes()
+	id := routes[0].ID
+
+	// The generated ID is written right away and survives a restart.
+	reloaded, err := config.LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reloaded.Routes) != 1 || reloaded.Routes[0].ID != id || reloaded.Server.Address != ":9090" {
+		t.Fatalf("after first write: %+v", reloaded)
+	}
+
+	added := &config.RouteConfig{Path: "/b", Methods: []string{"POST"}, Upstream: "http://b"}
+	if err := store.SaveRoute(added); err != nil {
+		t.Fatal(err)
+	}
+	update := routes[0]
+	update.Upstream = "http://a2"
+	if err := store.UpdateRoute(&update, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	restarted, err := config.NewYAMLFileRouteStore(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := restarted.GetRoute(id)
+	if err != nil || a.Upstream != "http://a2" || a.Revision != 2 || a.Plugins[0].Name != "logging" {
+		t.Errorf("route a after restart: %+v, %v", a, err)
+	}
+	if _, err := restarted.GetRoute(added.ID); err != nil {
+		t.Errorf("route b after restart: %v", err)
+	}
+
+	data, _ := os.ReadFile(path)
+	for _, want := range []string{"# gateway settings", "# keep me", "- logging"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("written file lost %q:\n%s", want, data)
+		}
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0o600 {
+		t.Errorf("mode = %v, want 0600", info.Mode().Perm())
+	}
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("temporary files left behind: %v", entries)
+	}
+}
+
+func TestYAMLFileRouteStoreSeparateFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "routes.yaml")
+	seed := []config.RouteConfig{{Path: "/seed", Methods: []string{"GET"}, Upstream: "http://seed"}}
+
+	store, err := config.NewYAMLFileRouteStore(path, seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	routes, _ := store.LoadRoutes()
+	if err := store.DeleteRoute(routes[0].ID, config.AnyRevision); err != nil {
+		t.Fatal(err)
+	}
+
+	// Once the file exists its routes win over the seed, even when empty.
+	restarted, err := config.NewYAMLFileRouteStore(path, seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if routes, _ := restarted.LoadRoutes(); len(routes) != 0 {
+		t.Errorf("routes = %+v, want none", routes)
+	}
+}
+
+func TestYAMLFileRouteStoreReloadAfterOwnWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	store, err := config.NewYAMLFileRouteStore(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Plugin configs decoded from admin JSON hold float64 numbers.
+	route := &config.RouteConfig{Path: "/a", Methods: []string{"GET"}, Upstream: "http://a",
+		Plugins: []config.PluginConfig{{Name: "rate-limit", Config: map[string]interface{}{"limit": float64(10), "window": "1s"}}}}
+	if err := store.SaveRoute(route); err != nil {
+		t.Fatal(err)
+	}
+	written, _ := os.ReadFile(path)
+
+	// What the file watcher does after the store's own write.
+	fileRoutes, _, err := config.ReadRoutesFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolved := store.Resolve(fileRoutes)
+	if err := store.ReplaceRoutes(resolved); err != nil {
+		t.Fatal(err)
+	}
+	current, _ := store.GetRoute(route.ID)
+	if current.Revision != 1 {
+		t.Errorf("revision after reloading the store's own write: %d, want 1", current.Revision)
+	}
+	if after, _ := os.ReadFile(path); string(after) != string(written) {
+		t.Errorf("file rewritten by the reload:\n%s", after)
+	}
+}